@@ -0,0 +1,211 @@
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"slices"
+)
+
+// AccessSsm and AccessSsh are the ways operators get a shell on the
+// instances.
+const (
+	// AccessSsm opens sessions through SSM Session Manager, which needs no
+	// key pair and no inbound port.
+	AccessSsm = "ssm"
+	// AccessSsh is the legacy access with a key pair over port 22.
+	AccessSsh = "ssh"
+)
+
+// AccessModes lists the accepted access modes.
+var AccessModes = []string{AccessSsm, AccessSsh}
+
+// SshPort is the port only opened to the instances with AccessSsh.
+const SshPort = 22
+
+// LogRetentionDays are the retention periods CloudWatch Logs accepts.
+var LogRetentionDays = []int{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// SessionLogging configures where Session Manager records the sessions
+// opened on the instances.
+type SessionLogging struct {
+	// CloudWatch streams the sessions to a log group of the stack, kept for
+	// RetentionDays. Zero keeps the logs forever.
+	CloudWatch    bool `json:"cloudWatch"`
+	RetentionDays int  `json:"retentionDays"`
+	// S3Bucket is an existing bucket the sessions are uploaded to, under
+	// S3KeyPrefix.
+	S3Bucket    string `json:"s3Bucket"`
+	S3KeyPrefix string `json:"s3KeyPrefix"`
+}
+
+// Enabled reports whether the sessions are recorded anywhere.
+func (l SessionLogging) Enabled() bool {
+	return l.CloudWatch || l.S3Bucket != ""
+}
+
+// SessionManagerEndpoints returns the VPC endpoint services private
+// instances without a NAT need to open sessions and record them.
+func SessionManagerEndpoints(logging SessionLogging) []string {
+	services := []string{"ssm", "ssmmessages", "ec2messages"}
+	if logging.CloudWatch {
+		services = append(services, "logs")
+	}
+	if logging.S3Bucket != "" {
+		services = append(services, "s3")
+	}
+	return services
+}
+
+// InstancePorts returns the ports opened to the instances in an access
+// mode. Sessions need no inbound port, so SshPort is left out unless the
+// mode is AccessSsh.
+func InstancePorts(mode string, ports []int) []int {
+	if mode == AccessSsh {
+		return ports
+	}
+	return slices.DeleteFunc(slices.Clone(ports), func(port int) bool {
+		return port == SshPort
+	})
+}
+
+// sessionManagerArgs configures newSessionManager.
+type sessionManagerArgs struct {
+	Role      *iam.Role
+	Region    string
+	AccountId string
+	Logging   SessionLogging
+	Names     NameTags
+}
+
+// newSessionManager lets the instances of the role register with Session
+// Manager and, when logging is enabled, creates the session preferences
+// document that records the sessions. The document is nil otherwise.
+func newSessionManager(ctx *pulumi.Context, parent pulumi.Resource, args *sessionManagerArgs) (*ssm.Document, error) {
+	names := args.Names
+	logging := args.Logging
+
+	// The session channels cannot be scoped to a resource
+	statements := []policyStatement{
+		{
+			Sid:     "RegisterInstances",
+			Actions: []string{"ssm:UpdateInstanceInformation"},
+			Resources: []pulumi.StringInput{
+				pulumi.Sprintf("arn:aws:ec2:%s:%s:instance/*", args.Region, args.AccountId),
+			},
+		},
+		{
+			Sid: "OpenSessionChannels",
+			Actions: []string{
+				"ssmmessages:CreateControlChannel",
+				"ssmmessages:CreateDataChannel",
+				"ssmmessages:OpenControlChannel",
+				"ssmmessages:OpenDataChannel",
+			},
+			Resources: []pulumi.StringInput{pulumi.String("*")},
+		},
+	}
+
+	var document *ssm.Document
+	if logging.Enabled() {
+		inputs := map[string]interface{}{
+			"s3BucketName":                logging.S3Bucket,
+			"s3KeyPrefix":                 logging.S3KeyPrefix,
+			"s3EncryptionEnabled":         logging.S3Bucket != "",
+			"cloudWatchLogGroupName":      "",
+			"cloudWatchEncryptionEnabled": false,
+			"cloudWatchStreamingEnabled":  logging.CloudWatch,
+		}
+
+		if logging.CloudWatch {
+			var retention pulumi.IntPtrInput
+			if logging.RetentionDays > 0 {
+				retention = pulumi.Int(logging.RetentionDays)
+			}
+			_, err := cloudwatch.NewLogGroup(ctx, names.SessionLogGroupName, &cloudwatch.LogGroupArgs{
+				Name:            pulumi.String(names.SessionLogGroupName),
+				RetentionInDays: retention,
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(names.SessionLogGroupName),
+				},
+			}, childOptions(parent)...)
+			if err != nil {
+				return nil, err
+			}
+			inputs["cloudWatchLogGroupName"] = names.SessionLogGroupName
+			statements = append(statements,
+				policyStatement{
+					Sid: "WriteSessionLogs",
+					Actions: []string{
+						"logs:CreateLogStream",
+						"logs:DescribeLogStreams",
+						"logs:PutLogEvents",
+					},
+					Resources: []pulumi.StringInput{
+						logGroupArn(args.Region, args.AccountId, pulumi.String(names.SessionLogGroupName)),
+					},
+				},
+				// The agent looks the log group up before it streams to it
+				policyStatement{
+					Sid:     "FindSessionLogGroup",
+					Actions: []string{"logs:DescribeLogGroups"},
+					Resources: []pulumi.StringInput{
+						pulumi.Sprintf("arn:aws:logs:%s:%s:log-group:*", args.Region, args.AccountId),
+					},
+				},
+			)
+		}
+
+		if logging.S3Bucket != "" {
+			statements = append(statements,
+				policyStatement{
+					Sid:     "UploadSessionLogs",
+					Actions: []string{"s3:PutObject"},
+					Resources: []pulumi.StringInput{
+						pulumi.Sprintf("arn:aws:s3:::%s/%s*", logging.S3Bucket, logging.S3KeyPrefix),
+					},
+				},
+				policyStatement{
+					Sid:     "CheckSessionBucketEncryption",
+					Actions: []string{"s3:GetEncryptionConfiguration"},
+					Resources: []pulumi.StringInput{
+						pulumi.Sprintf("arn:aws:s3:::%s", logging.S3Bucket),
+					},
+				},
+			)
+		}
+
+		content, err := json.Marshal(map[string]interface{}{
+			"schemaVersion": "1.0",
+			"description":   fmt.Sprintf("Session preferences of %s", names.ApplicationInstanceName),
+			"sessionType":   "Standard_Stream",
+			"inputs":        inputs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		document, err = ssm.NewDocument(ctx, names.SessionPreferencesName, &ssm.DocumentArgs{
+			DocumentType:   pulumi.String("Session"),
+			DocumentFormat: pulumi.String("JSON"),
+			Content:        pulumi.String(string(content)),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.SessionPreferencesName),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := iam.NewRolePolicy(ctx, names.SessionManagerPolicyName, &iam.RolePolicyArgs{
+		Role:   args.Role.Name,
+		Policy: policyDocument(statements...),
+	}, childOptions(parent)...)
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
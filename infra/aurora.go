@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ServerlessInstanceClass is the instance class of the instances of an
+// Aurora Serverless v2 cluster.
+const ServerlessInstanceClass = "db.serverless"
+
+// MinServerlessCapacity and MaxServerlessCapacity bound the Aurora capacity
+// units of Serverless v2, which are set in steps of half a unit.
+const (
+	MinServerlessCapacity = 0.5
+	MaxServerlessCapacity = 128
+)
+
+// MaxReaders is the most readers an Aurora cluster can have.
+const MaxReaders = 15
+
+// ServerlessCapacity is the range of Aurora capacity units the instances of
+// an Aurora Serverless v2 cluster scale in.
+type ServerlessCapacity struct {
+	MinCapacity float64 `json:"minCapacity"`
+	MaxCapacity float64 `json:"maxCapacity"`
+}
+
+// newAuroraCluster creates the parameter groups, Aurora cluster, writer and
+// readers of the DatabaseAurora backend. The writer is created
+// first, and the readers after it.
+func newAuroraCluster(ctx *pulumi.Context, database *Database, args *DatabaseArgs, settings *databaseSettings) (*databaseEndpoint, error) {
+	names := args.Names
+	hardening := args.Hardening
+
+	// The parameters apply to every instance of the cluster
+	parameterGroup, err := rds.NewClusterParameterGroup(ctx, names.DatabaseClusterParameterGroupName, &rds.ClusterParameterGroupArgs{
+		Family:     pulumi.String(args.Family),
+		Parameters: clusterParameterGroupParameters(args.Parameters),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseClusterParameterGroupName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The instance parameters apply to each instance, writer and readers
+	instanceParameterGroup, err := rds.NewParameterGroup(ctx, names.DatabaseParameterGroupName, &rds.ParameterGroupArgs{
+		Family:     pulumi.String(args.Family),
+		Parameters: parameterGroupParameters(args.InstanceParameters),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseParameterGroupName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceClass := args.InstanceClass
+	var scaling rds.ClusterServerlessv2ScalingConfigurationPtrInput
+	if args.Serverless != nil {
+		instanceClass = ServerlessInstanceClass
+		scaling = rds.ClusterServerlessv2ScalingConfigurationArgs{
+			MinCapacity: pulumi.Float64(args.Serverless.MinCapacity),
+			MaxCapacity: pulumi.Float64(args.Serverless.MaxCapacity),
+		}
+	}
+
+	cluster, err := rds.NewCluster(ctx, names.DatabaseClusterName, &rds.ClusterArgs{
+		Engine:                           pulumi.String(args.Engine),
+		EngineVersion:                    pulumi.String(args.EngineVersion),
+		DatabaseName:                     pulumi.String(args.Name),
+		Port:                             pulumi.Int(args.Port),
+		MasterUsername:                   pulumi.String(args.MasterUser),
+		MasterPassword:                   settings.Password,
+		DbSubnetGroupName:                settings.SubnetGroupName,
+		DbClusterParameterGroupName:      parameterGroup.Name,
+		VpcSecurityGroupIds:              pulumi.StringArray{args.SecurityGroupId},
+		StorageEncrypted:                 pulumi.Bool(hardening.StorageEncrypted),
+		KmsKeyId:                         settings.KmsKeyId,
+		DeletionProtection:               pulumi.Bool(hardening.DeletionProtection),
+		BackupRetentionPeriod:            pulumi.Int(hardening.BackupRetentionDays),
+		PreferredBackupWindow:            settings.BackupWindow,
+		SkipFinalSnapshot:                pulumi.Bool(hardening.SkipFinalSnapshot),
+		FinalSnapshotIdentifier:          settings.FinalSnapshotIdentifier,
+		CopyTagsToSnapshot:               pulumi.Bool(true),
+		Serverlessv2ScalingConfiguration: scaling,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseClusterName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aurora makes the first instance of the cluster its writer
+	var writer *rds.ClusterInstance
+	for index := 1; index <= args.Readers+1; index++ {
+		instanceName := names.Indexed(names.DatabaseClusterInstanceName, index)
+		var opts []pulumi.ResourceOption
+		if writer != nil {
+			opts = append(opts, pulumi.DependsOn([]pulumi.Resource{writer}))
+		}
+		instance, err := rds.NewClusterInstance(ctx, instanceName, &rds.ClusterInstanceArgs{
+			ClusterIdentifier:          cluster.ID(),
+			Engine:                     pulumi.String(args.Engine),
+			EngineVersion:              pulumi.String(args.EngineVersion),
+			InstanceClass:              pulumi.String(instanceClass),
+			DbSubnetGroupName:          settings.SubnetGroupName,
+			DbParameterGroupName:       instanceParameterGroup.Name,
+			PubliclyAccessible:         pulumi.Bool(false),
+			PerformanceInsightsEnabled: pulumi.Bool(hardening.PerformanceInsights),
+			MonitoringInterval:         pulumi.Int(hardening.MonitoringInterval),
+			MonitoringRoleArn:          settings.MonitoringRoleArn,
+			CopyTagsToSnapshot:         pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(instanceName),
+			},
+		}, childOptions(database, opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		if writer == nil {
+			writer = instance
+		}
+	}
+
+	database.Cluster = cluster
+	database.ReaderAddress = cluster.ReaderEndpoint
+	return &databaseEndpoint{
+		Address:  cluster.Endpoint,
+		Endpoint: pulumi.Sprintf("%s:%d", cluster.Endpoint, cluster.Port),
+		Port:     cluster.Port,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+)
+
+// CertificateLookup and CertificateIssue are the ways the web tier gets the
+// certificate of the application domain.
+const (
+	// CertificateLookup uses an issued certificate that was imported or
+	// requested outside the stack.
+	CertificateLookup = "lookup"
+	// CertificateIssue requests the certificate from ACM and validates it
+	// through DNS records in the hosted zone of the domain.
+	CertificateIssue = "issue"
+)
+
+// CertificateModes lists the accepted certificate modes.
+var CertificateModes = []string{CertificateLookup, CertificateIssue}
+
+// validatedCertificateArgs holds what newValidatedCertificate needs from the
+// web tier.
+type validatedCertificateArgs struct {
+	DomainName string
+	// SubjectAlternativeNames are the other domains of the certificate, e.g.
+	// www.example.com or *.example.com.
+	SubjectAlternativeNames []string
+	ZoneId                  pulumi.StringInput
+	Names                   NameTags
+}
+
+// newValidatedCertificate requests a certificate from ACM, creates the DNS
+// records that prove ownership of its domains and returns its ARN once ACM
+// has issued it.
+func newValidatedCertificate(ctx *pulumi.Context, parent pulumi.Resource, args *validatedCertificateArgs) (pulumi.StringOutput, error) {
+	names := args.Names
+
+	// Request the certificate
+	certificate, err := acm.NewCertificate(ctx, names.CertificateName, &acm.CertificateArgs{
+		DomainName:              pulumi.String(args.DomainName),
+		SubjectAlternativeNames: pulumi.ToStringArray(args.SubjectAlternativeNames),
+		ValidationMethod:        pulumi.String("DNS"),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.CertificateName),
+		},
+	}, childOptions(parent)...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// A wildcard shares the validation record of its base domain, so only
+	// one record is created for both
+	var domains []string
+	seen := map[string]bool{}
+	for _, domain := range append([]string{args.DomainName}, args.SubjectAlternativeNames...) {
+		base := strings.TrimPrefix(domain, "*.")
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		domains = append(domains, domain)
+	}
+
+	// Create the validation records in the hosted zone
+	options := certificate.DomainValidationOptions
+	var fqdns pulumi.StringArray
+	for i, domain := range domains {
+		domain := domain
+		option := options.ApplyT(func(options []acm.CertificateDomainValidationOption) (acm.CertificateDomainValidationOption, error) {
+			for _, option := range options {
+				if option.DomainName != nil && *option.DomainName == domain {
+					return option, nil
+				}
+			}
+			return acm.CertificateDomainValidationOption{}, fmt.Errorf("certificate has no validation record for %s", domain)
+		}).(acm.CertificateDomainValidationOptionOutput)
+
+		record, err := route53.NewRecord(ctx, names.Indexed(names.CertificateValidationRecordName, i+1), &route53.RecordArgs{
+			ZoneId:         args.ZoneId,
+			Name:           option.ResourceRecordName().Elem(),
+			Type:           option.ResourceRecordType().Elem(),
+			Records:        pulumi.StringArray{option.ResourceRecordValue().Elem()},
+			Ttl:            pulumi.Int(60),
+			AllowOverwrite: pulumi.Bool(true),
+		}, childOptions(parent)...)
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		fqdns = append(fqdns, record.Fqdn)
+	}
+
+	// Wait for ACM to issue the certificate
+	validation, err := acm.NewCertificateValidation(ctx, names.CertificateValidationName, &acm.CertificateValidationArgs{
+		CertificateArn:        certificate.Arn,
+		ValidationRecordFqdns: fqdns,
+	}, childOptions(parent)...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	return validation.CertificateArn, nil
+}
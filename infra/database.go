@@ -0,0 +1,421 @@
+package infra
+
+import (
+	"encoding/json"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+)
+
+// PasswordGenerate and PasswordConfig are the ways the database gets its
+// master password. The password RDS can manage is not offered: RDS rotates
+// it, while the instances only read the password at boot.
+const (
+	// PasswordGenerate generates a random password in the stack.
+	PasswordGenerate = "generate"
+	// PasswordConfig uses the secret password of the stack configuration.
+	PasswordConfig = "config"
+)
+
+// PasswordModes lists the accepted password modes.
+var PasswordModes = []string{PasswordGenerate, PasswordConfig}
+
+// DatabaseInstance and DatabaseAurora are the backends that serve the
+// database.
+const (
+	// DatabaseInstance is a single RDS instance, in a standby pair with
+	// MultiAz.
+	DatabaseInstance = "instance"
+	// DatabaseAurora is an Aurora cluster of a writer and its readers.
+	DatabaseAurora = "aurora"
+)
+
+// DatabaseBackend returns the backend of an engine. Aurora engines only run
+// in clusters.
+func DatabaseBackend(engine string) string {
+	if strings.HasPrefix(engine, "aurora-") {
+		return DatabaseAurora
+	}
+	return DatabaseInstance
+}
+
+// DatabaseProfileDev and DatabaseProfileProd name the presets of the
+// hardening options of the database.
+const (
+	DatabaseProfileDev  = "dev"
+	DatabaseProfileProd = "prod"
+)
+
+// DatabaseHardening holds the options that protect the data of the database.
+type DatabaseHardening struct {
+	// StorageEncrypted encrypts the storage with the KMS key KmsKeyId, or with
+	// the AWS managed key when it is empty. Changing it replaces the instance.
+	StorageEncrypted bool
+	KmsKeyId         string
+	MultiAz          bool
+	// DeletionProtection keeps the instance from being deleted until it is
+	// turned off.
+	DeletionProtection bool
+	// BackupRetentionDays is how long automated backups are kept; zero turns
+	// them off. BackupWindow is the daily hh24:mi-hh24:mi UTC range they are
+	// taken in, chosen by AWS when it is empty.
+	BackupRetentionDays int
+	BackupWindow        string
+	// SkipFinalSnapshot deletes the instance without the snapshot named
+	// after DatabaseFinalSnapshotName.
+	SkipFinalSnapshot   bool
+	PerformanceInsights bool
+	// MonitoringInterval is the period of enhanced monitoring in seconds.
+	// Zero turns it off.
+	MonitoringInterval int
+}
+
+// DatabaseProfiles are the presets of the hardening options. The dev preset
+// keeps the settings the database has always had.
+var DatabaseProfiles = map[string]DatabaseHardening{
+	DatabaseProfileDev: {
+		BackupRetentionDays: 1,
+		SkipFinalSnapshot:   true,
+	},
+	DatabaseProfileProd: {
+		StorageEncrypted:    true,
+		MultiAz:             true,
+		DeletionProtection:  true,
+		BackupRetentionDays: 7,
+		PerformanceInsights: true,
+		MonitoringInterval:  60,
+	},
+}
+
+// MonitoringIntervals are the enhanced monitoring periods RDS accepts.
+var MonitoringIntervals = []int{0, 1, 5, 10, 15, 30, 60}
+
+// DatabaseArgs configures the RDS instance of the application.
+type DatabaseArgs struct {
+	SubnetIds       pulumi.StringArrayInput
+	SecurityGroupId pulumi.StringInput
+	Family          string
+	StorageSize     int
+	Engine          string
+	EngineVersion   string
+	InstanceClass   string
+	Port            int
+	Name            string
+	MasterUser      string
+	// PasswordMode is how the master password is obtained. Defaults to
+	// PasswordGenerate.
+	PasswordMode string
+	// MasterPassword is only used with PasswordConfig.
+	MasterPassword pulumi.StringInput
+	// Parameters are rendered into the parameter group of Family, which is
+	// the cluster parameter group with DatabaseAurora. InstanceParameters
+	// are only used with DatabaseAurora, and go to the parameter group of
+	// the instances of the cluster.
+	Parameters         map[string]DatabaseParameter
+	InstanceParameters map[string]DatabaseParameter
+	// Options are the options of the option group of the database, which
+	// is only created when there are some.
+	Options []DatabaseOption
+	// Readers and Serverless are only used with DatabaseAurora. Serverless
+	// replaces InstanceClass when it is set.
+	Readers    int
+	Serverless *ServerlessCapacity
+	Hardening  DatabaseHardening
+	// Region is where the enhanced monitoring metrics are written.
+	Region string
+	Names  NameTags
+}
+
+// Database is an RDS instance or an Aurora cluster in the private subnets of
+// the network.
+type Database struct {
+	pulumi.ResourceState
+
+	// Instance is nil with DatabaseAurora, and Cluster with DatabaseInstance.
+	Instance *rds.Instance
+	Cluster  *rds.Cluster
+	// Address is the endpoint of the instance or of the writer of the
+	// cluster. ReaderAddress balances the readers of the cluster and is
+	// only set with DatabaseAurora.
+	Address       pulumi.StringOutput
+	ReaderAddress pulumi.StringOutput
+	Endpoint      pulumi.StringOutput
+	Port          pulumi.IntOutput
+	// PasswordSecretArn is the Secrets Manager secret of the master
+	// credentials. Like the secrets RDS manages, it holds a JSON object with
+	// a username and a password.
+	PasswordSecretArn pulumi.StringOutput
+	// PasswordVersionId changes whenever the password does.
+	PasswordVersionId pulumi.StringOutput
+}
+
+// NewDatabase creates the subnet group and master credentials secret of the
+// database, then the instance or cluster of its backend.
+func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...pulumi.ResourceOption) (*Database, error) {
+	database := &Database{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:Database", name, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	if err := checkParameterGroupFamily(ctx, database, args); err != nil {
+		return nil, err
+	}
+
+	// Create a database subnet group
+	databaseSubnetGroup, err := rds.NewSubnetGroup(ctx, names.DatabaseSubnetGroupName, &rds.SubnetGroupArgs{
+		SubnetIds: args.SubnetIds,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseSubnetGroupName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the master credentials in Secrets Manager
+	password := args.MasterPassword
+	if args.PasswordMode != PasswordConfig {
+		// Letters and digits only, so that the password needs no quoting
+		// in the environment file of the application
+		generated, err := random.NewRandomPassword(ctx, names.DatabasePasswordName, &random.RandomPasswordArgs{
+			Length:  pulumi.Int(32),
+			Special: pulumi.Bool(false),
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		password = generated.Result
+	}
+	secret, err := newSecret(ctx, database, &secretArgs{
+		Name:        names.DatabaseSecretName,
+		VersionName: names.DatabaseSecretVersionName,
+		Description: "Master credentials of the database",
+		Value: password.ToStringOutput().ApplyT(func(password string) (string, error) {
+			credentials, err := json.Marshal(map[string]string{
+				"username": args.MasterUser,
+				"password": password,
+			})
+			return string(credentials), err
+		}).(pulumi.StringOutput),
+	})
+	if err != nil {
+		return nil, err
+	}
+	secretArn := secret.Arn
+
+	// Let RDS publish the enhanced monitoring metrics
+	hardening := args.Hardening
+	var monitoringRoleArn pulumi.StringPtrInput
+	if hardening.MonitoringInterval > 0 {
+		role, err := newMonitoringRole(ctx, database, args)
+		if err != nil {
+			return nil, err
+		}
+		monitoringRoleArn = role.Arn
+	}
+
+	// Keep a final snapshot of the data when the instance is deleted
+	var finalSnapshotIdentifier pulumi.StringPtrInput
+	if !hardening.SkipFinalSnapshot {
+		finalSnapshotIdentifier = pulumi.String(names.DatabaseFinalSnapshotName)
+	}
+	var kmsKeyId pulumi.StringPtrInput
+	if hardening.KmsKeyId != "" {
+		kmsKeyId = pulumi.String(hardening.KmsKeyId)
+	}
+	var backupWindow pulumi.StringPtrInput
+	if hardening.BackupWindow != "" {
+		backupWindow = pulumi.String(hardening.BackupWindow)
+	}
+
+	settings := &databaseSettings{
+		SubnetGroupName:         databaseSubnetGroup.Name,
+		Password:                password,
+		MonitoringRoleArn:       monitoringRoleArn,
+		FinalSnapshotIdentifier: finalSnapshotIdentifier,
+		KmsKeyId:                kmsKeyId,
+		BackupWindow:            backupWindow,
+	}
+	newBackend := newDatabaseInstance
+	if DatabaseBackend(args.Engine) == DatabaseAurora {
+		newBackend = newAuroraCluster
+	}
+	endpoint, err := newBackend(ctx, database, args, settings)
+	if err != nil {
+		return nil, err
+	}
+	database.Address = endpoint.Address
+	database.Endpoint = endpoint.Endpoint
+	database.Port = endpoint.Port
+	database.PasswordSecretArn = secretArn
+	database.PasswordVersionId = secret.Version.VersionId
+
+	if err := ctx.RegisterResourceOutputs(database, pulumi.Map{
+		"address":           endpoint.Address,
+		"endpoint":          endpoint.Endpoint,
+		"port":              endpoint.Port,
+		"passwordSecretArn": secretArn,
+	}); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// databaseSettings are the resources and settings NewDatabase shares with
+// the backend of the database.
+type databaseSettings struct {
+	SubnetGroupName         pulumi.StringOutput
+	Password                pulumi.StringInput
+	MonitoringRoleArn       pulumi.StringPtrInput
+	FinalSnapshotIdentifier pulumi.StringPtrInput
+	KmsKeyId                pulumi.StringPtrInput
+	BackupWindow            pulumi.StringPtrInput
+}
+
+// databaseEndpoint is where a backend serves the database. The web tier
+// connects to it the same way whichever backend it is.
+type databaseEndpoint struct {
+	Address  pulumi.StringOutput
+	Endpoint pulumi.StringOutput
+	Port     pulumi.IntOutput
+}
+
+// newDatabaseInstance creates the parameter group, option group and RDS
+// instance of the DatabaseInstance backend.
+func newDatabaseInstance(ctx *pulumi.Context, database *Database, args *DatabaseArgs, settings *databaseSettings) (*databaseEndpoint, error) {
+	names := args.Names
+	hardening := args.Hardening
+
+	// Create a database parameter group
+	databaseParameterGroup, err := rds.NewParameterGroup(ctx, names.DatabaseParameterGroupName, &rds.ParameterGroupArgs{
+		Family:     pulumi.String(args.Family),
+		Parameters: parameterGroupParameters(args.Parameters),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseParameterGroupName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an option group for the plugins of the engine
+	var optionGroupName pulumi.StringPtrInput
+	if len(args.Options) > 0 {
+		optionGroup, err := rds.NewOptionGroup(ctx, names.DatabaseOptionGroupName, &rds.OptionGroupArgs{
+			EngineName:             pulumi.String(args.Engine),
+			MajorEngineVersion:     pulumi.String(MajorEngineVersion(args.Engine, args.EngineVersion)),
+			OptionGroupDescription: pulumi.String("Options of " + names.DatabaseInstanceName),
+			Options:                optionGroupOptions(args.Options),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.DatabaseOptionGroupName),
+			},
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		optionGroupName = optionGroup.Name
+	}
+
+	// Create a database instance
+	databaseInstance, err := rds.NewInstance(ctx, names.DatabaseInstanceName, &rds.InstanceArgs{
+		AllocatedStorage:           pulumi.Int(args.StorageSize),
+		Engine:                     pulumi.String(args.Engine),
+		EngineVersion:              pulumi.String(args.EngineVersion),
+		InstanceClass:              pulumi.String(args.InstanceClass),
+		DbName:                     pulumi.String(args.Name),
+		Port:                       pulumi.Int(args.Port),
+		Username:                   pulumi.String(args.MasterUser),
+		Password:                   settings.Password,
+		MultiAz:                    pulumi.Bool(hardening.MultiAz),
+		PubliclyAccessible:         pulumi.Bool(false),
+		DbSubnetGroupName:          settings.SubnetGroupName,
+		ParameterGroupName:         databaseParameterGroup.Name,
+		OptionGroupName:            optionGroupName,
+		VpcSecurityGroupIds:        pulumi.StringArray{args.SecurityGroupId},
+		StorageEncrypted:           pulumi.Bool(hardening.StorageEncrypted),
+		KmsKeyId:                   settings.KmsKeyId,
+		DeletionProtection:         pulumi.Bool(hardening.DeletionProtection),
+		BackupRetentionPeriod:      pulumi.Int(hardening.BackupRetentionDays),
+		BackupWindow:               settings.BackupWindow,
+		SkipFinalSnapshot:          pulumi.Bool(hardening.SkipFinalSnapshot),
+		FinalSnapshotIdentifier:    settings.FinalSnapshotIdentifier,
+		CopyTagsToSnapshot:         pulumi.Bool(true),
+		PerformanceInsightsEnabled: pulumi.Bool(hardening.PerformanceInsights),
+		MonitoringInterval:         pulumi.Int(hardening.MonitoringInterval),
+		MonitoringRoleArn:          settings.MonitoringRoleArn,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseInstanceName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	database.Instance = databaseInstance
+	return &databaseEndpoint{
+		Address:  databaseInstance.Address,
+		Endpoint: databaseInstance.Endpoint,
+		Port:     databaseInstance.Port,
+	}, nil
+}
+
+// newMonitoringRole creates the role RDS assumes to write the enhanced
+// monitoring metrics to the RDSOSMetrics log group.
+func newMonitoringRole(ctx *pulumi.Context, database *Database, args *DatabaseArgs) (*iam.Role, error) {
+	names := args.Names
+	assumeRolePolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Action": "sts:AssumeRole",
+				"Effect": "Allow",
+				"Principal": map[string]interface{}{
+					"Service": "monitoring.rds.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.NewRole(ctx, names.DatabaseMonitoringRoleName, &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(string(assumeRolePolicy)),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseMonitoringRoleName),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := aws.GetCallerIdentity(ctx, nil, pulumi.Parent(database))
+	if err != nil {
+		return nil, err
+	}
+	_, err = iam.NewRolePolicy(ctx, names.DatabaseMonitoringPolicyName, &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: policyDocument(policyStatement{
+			Sid: "WriteMonitoringMetrics",
+			Actions: []string{
+				"logs:CreateLogGroup",
+				"logs:CreateLogStream",
+				"logs:DescribeLogStreams",
+				"logs:GetLogEvents",
+				"logs:PutLogEvents",
+				"logs:PutRetentionPolicy",
+			},
+			Resources: []pulumi.StringInput{
+				logGroupArn(args.Region, identity.AccountId, pulumi.String("RDSOSMetrics")),
+			},
+		}),
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
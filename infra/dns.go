@@ -0,0 +1,104 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// HostedZoneLookup and HostedZoneCreate are the ways the stack gets the
+// hosted zone of the application domain.
+const (
+	// HostedZoneLookup uses a zone that already exists.
+	HostedZoneLookup = "lookup"
+	// HostedZoneCreate creates the zone in the stack.
+	HostedZoneCreate = "create"
+)
+
+// HostedZoneModes lists the accepted hosted zone modes.
+var HostedZoneModes = []string{HostedZoneLookup, HostedZoneCreate}
+
+// DnsZoneArgs configures the hosted zone of the application domain.
+type DnsZoneArgs struct {
+	DomainName string
+	// Mode is HostedZoneLookup (the default) or HostedZoneCreate.
+	Mode string
+	// ParentZoneId is the zone the created zone is delegated from, e.g. the
+	// zone of example.com for dev.example.com. No delegation is created when
+	// it is empty.
+	ParentZoneId string
+	// ParentProvider manages the parent zone when it lives in another
+	// account. The stack's provider is used when it is nil.
+	ParentProvider pulumi.ProviderResource
+	Names          NameTags
+}
+
+// DnsZone is the hosted zone the application records are created in.
+type DnsZone struct {
+	pulumi.ResourceState
+
+	ZoneId pulumi.StringOutput
+	// NameServers are only known when the zone is created by the stack.
+	NameServers pulumi.StringArrayOutput
+}
+
+// NewDnsZone looks up or creates the hosted zone of the domain and, when it
+// is created, delegates it from its parent zone.
+func NewDnsZone(ctx *pulumi.Context, name string, args *DnsZoneArgs, opts ...pulumi.ResourceOption) (*DnsZone, error) {
+	dnsZone := &DnsZone{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:DnsZone", name, dnsZone, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	if args.Mode != HostedZoneCreate {
+		// Get the zone for application domain
+		zone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+			Name: pulumi.StringRef(args.DomainName),
+		}, pulumi.Parent(dnsZone))
+		if err != nil {
+			return nil, err
+		}
+		dnsZone.ZoneId = pulumi.String(zone.Id).ToStringOutput()
+		dnsZone.NameServers = pulumi.ToStringArray(zone.NameServers).ToStringArrayOutput()
+	} else {
+		// Create the zone for application domain
+		zone, err := route53.NewZone(ctx, names.HostedZoneName, &route53.ZoneArgs{
+			Name: pulumi.String(args.DomainName),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.HostedZoneName),
+			},
+		}, childOptions(dnsZone)...)
+		if err != nil {
+			return nil, err
+		}
+		dnsZone.ZoneId = zone.ZoneId
+		dnsZone.NameServers = zone.NameServers
+
+		// Delegate the zone from its parent
+		if args.ParentZoneId != "" {
+			delegationOpts := childOptions(dnsZone)
+			if args.ParentProvider != nil {
+				delegationOpts = append(delegationOpts, pulumi.Provider(args.ParentProvider))
+			}
+			_, err = route53.NewRecord(ctx, names.ZoneDelegationName, &route53.RecordArgs{
+				ZoneId:  pulumi.String(args.ParentZoneId),
+				Name:    pulumi.String(args.DomainName),
+				Type:    pulumi.String("NS"),
+				Ttl:     pulumi.Int(300),
+				Records: zone.NameServers,
+			}, delegationOpts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := ctx.RegisterResourceOutputs(dnsZone, pulumi.Map{
+		"zoneId":      dnsZone.ZoneId,
+		"nameServers": dnsZone.NameServers,
+	}); err != nil {
+		return nil, err
+	}
+	return dnsZone, nil
+}
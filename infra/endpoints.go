@@ -0,0 +1,154 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"slices"
+	"sort"
+)
+
+// vpcEndpointTypes maps the AWS services that can be reached through a VPC
+// endpoint to the type of their endpoint. Gateway endpoints are free and
+// routed through the route tables, interface endpoints are network
+// interfaces in the subnets.
+var vpcEndpointTypes = map[string]string{
+	"dynamodb":       "Gateway",
+	"s3":             "Gateway",
+	"logs":           "Interface",
+	"monitoring":     "Interface",
+	"sns":            "Interface",
+	"ssm":            "Interface",
+	"ssmmessages":    "Interface",
+	"ec2messages":    "Interface",
+	"secretsmanager": "Interface",
+}
+
+// VpcEndpointServices returns the services a VPC endpoint can be created for.
+func VpcEndpointServices() []string {
+	services := make([]string, 0, len(vpcEndpointTypes))
+	for service := range vpcEndpointTypes {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// InstanceEndpoints returns the VPC endpoint services the instances call in
+// an access mode: the CloudWatch agent, the application and, with AccessSsm,
+// Session Manager. Once VPC endpoints narrow the HTTPS egress of the
+// instances, they can reach no other service.
+func InstanceEndpoints(accessMode string, logging SessionLogging) []string {
+	services := []string{"logs", "monitoring", "secretsmanager", "sns"}
+	if accessMode == AccessSsm {
+		for _, service := range SessionManagerEndpoints(logging) {
+			if !slices.Contains(services, service) {
+				services = append(services, service)
+			}
+		}
+	}
+	return services
+}
+
+// VpcEndpointsArgs configures the VPC endpoints of the stack.
+type VpcEndpointsArgs struct {
+	VpcId  pulumi.StringInput
+	Region string
+	// Services are the AWS services to create an endpoint for, e.g. logs or
+	// dynamodb. See VpcEndpointServices.
+	Services []string
+	// SubnetIds are the subnets the interface endpoints are placed in, one
+	// per availability zone.
+	SubnetIds pulumi.StringArray
+	// RouteTableIds are the route tables the gateway endpoints are added to.
+	RouteTableIds pulumi.StringArray
+	// SecurityGroupId is attached to the interface endpoints.
+	SecurityGroupId pulumi.StringInput
+	// ApplicationSecurityGroupId is given egress to the gateway endpoints.
+	ApplicationSecurityGroupId pulumi.StringInput
+	Names                      NameTags
+}
+
+// VpcEndpoints lets the application reach AWS services without going
+// through the internet.
+type VpcEndpoints struct {
+	pulumi.ResourceState
+
+	// Endpoints holds the endpoint of every service.
+	Endpoints map[string]*ec2.VpcEndpoint
+}
+
+// NewVpcEndpoints creates the gateway and interface endpoints, and the egress
+// rules from the application to the gateway endpoints.
+func NewVpcEndpoints(ctx *pulumi.Context, name string, args *VpcEndpointsArgs, opts ...pulumi.ResourceOption) (*VpcEndpoints, error) {
+	endpoints := &VpcEndpoints{Endpoints: map[string]*ec2.VpcEndpoint{}}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:VpcEndpoints", name, endpoints, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	endpointIds := pulumi.StringMap{}
+	for _, service := range args.Services {
+		endpointType, ok := vpcEndpointTypes[service]
+		if !ok {
+			return nil, fmt.Errorf("no VPC endpoint is known for service %q", service)
+		}
+		endpointName, err := names.VpcEndpointName(service)
+		if err != nil {
+			return nil, err
+		}
+
+		endpointArgs := &ec2.VpcEndpointArgs{
+			VpcId:           args.VpcId,
+			ServiceName:     pulumi.String(fmt.Sprintf("com.amazonaws.%s.%s", args.Region, service)),
+			VpcEndpointType: pulumi.String(endpointType),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(endpointName),
+			},
+		}
+		if endpointType == "Gateway" {
+			endpointArgs.RouteTableIds = args.RouteTableIds
+		} else {
+			endpointArgs.SubnetIds = args.SubnetIds
+			endpointArgs.SecurityGroupIds = pulumi.StringArray{args.SecurityGroupId}
+			endpointArgs.PrivateDnsEnabled = pulumi.Bool(true)
+		}
+
+		// Create the endpoint of the service
+		endpoint, err := ec2.NewVpcEndpoint(ctx, endpointName, endpointArgs, childOptions(endpoints)...)
+		if err != nil {
+			return nil, err
+		}
+		endpoints.Endpoints[service] = endpoint
+		endpointIds[service] = endpoint.ID()
+
+		if endpointType != "Gateway" {
+			continue
+		}
+
+		// Let the application reach the gateway endpoint through its prefix list
+		egressName, err := names.EndpointEgressName(service)
+		if err != nil {
+			return nil, err
+		}
+		_, err = ec2.NewSecurityGroupRule(ctx, egressName, &ec2.SecurityGroupRuleArgs{
+			Type:            pulumi.String("egress"),
+			FromPort:        pulumi.Int(443),
+			ToPort:          pulumi.Int(443),
+			Protocol:        pulumi.String("tcp"),
+			SecurityGroupId: args.ApplicationSecurityGroupId,
+			PrefixListIds:   pulumi.StringArray{endpoint.PrefixListId},
+		}, childOptions(endpoints)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.RegisterResourceOutputs(endpoints, pulumi.Map{
+		"endpointIds": endpointIds,
+	}); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,89 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-gcp/sdk/v6/go/gcp/serviceaccount"
+	"github.com/pulumi/pulumi-gcp/sdk/v6/go/gcp/storage"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// GcpArtifactStoreArgs configures the bucket that stores submission artifacts.
+type GcpArtifactStoreArgs struct {
+	Project string
+	Names   NameTags
+}
+
+// GcpArtifactStore is a private GCS bucket and a service account with a key
+// that is allowed to administer it.
+type GcpArtifactStore struct {
+	pulumi.ResourceState
+
+	Bucket         *storage.Bucket
+	ServiceAccount *serviceaccount.Account
+	BucketName     pulumi.StringOutput
+	// PrivateKey is the key of the service account, marked as a secret.
+	PrivateKey pulumi.StringOutput
+}
+
+// NewGcpArtifactStore creates the bucket, service account, key and bucket grant.
+func NewGcpArtifactStore(ctx *pulumi.Context, name string, args *GcpArtifactStoreArgs, opts ...pulumi.ResourceOption) (*GcpArtifactStore, error) {
+	store := &GcpArtifactStore{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:GcpArtifactStore", name, store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	//Create a Google Cloud Storage Bucket
+	bucket, err := storage.NewBucket(ctx, names.BucketName, &storage.BucketArgs{
+		Location:               pulumi.String("US"),
+		Name:                   pulumi.String(names.BucketName),
+		Project:                pulumi.String(args.Project),
+		StorageClass:           pulumi.String("STANDARD"),
+		PublicAccessPrevention: pulumi.String("enforced"),
+	}, childOptions(store)...)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create a Service Account for Bucket
+	serviceAccount, err := serviceaccount.NewAccount(ctx, names.ServiceAccountName, &serviceaccount.AccountArgs{
+		AccountId:   pulumi.String(names.ServiceAccountId),
+		DisplayName: pulumi.String(names.ServiceAccountName),
+		Project:     pulumi.String(args.Project),
+	}, childOptions(store)...)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create Access Keys
+	accessKey, err := serviceaccount.NewKey(ctx, names.ServiceAccountKeyName, &serviceaccount.KeyArgs{
+		ServiceAccountId: serviceAccount.Name,
+		PublicKeyType:    pulumi.String("TYPE_X509_PEM_FILE"),
+	}, childOptions(store)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Access Grant for the Bucket to the Service Account
+	_, err = storage.NewBucketIAMMember(ctx, names.BucketBindingName, &storage.BucketIAMMemberArgs{
+		Bucket: bucket.Name,
+		Role:   pulumi.String("roles/storage.admin"),
+		Member: serviceAccount.Member,
+	}, childOptions(store)...)
+	if err != nil {
+		return nil, err
+	}
+
+	store.Bucket = bucket
+	store.ServiceAccount = serviceAccount
+	store.BucketName = bucket.Name
+	store.PrivateKey = pulumi.ToSecret(accessKey.PrivateKey).(pulumi.StringOutput)
+
+	if err := ctx.RegisterResourceOutputs(store, pulumi.Map{
+		"bucketName":          bucket.Name,
+		"serviceAccountEmail": serviceAccount.Email,
+	}); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
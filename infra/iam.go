@@ -0,0 +1,52 @@
+package infra
+
+import (
+	"encoding/json"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// policyStatement is an Allow statement of an IAM policy. Its resources may
+// be outputs of other resources of the stack.
+type policyStatement struct {
+	Sid       string
+	Actions   []string
+	Resources []pulumi.StringInput
+}
+
+// policyDocument renders the statements as an IAM policy document once all of
+// their resources are known.
+func policyDocument(statements ...policyStatement) pulumi.StringOutput {
+	var resources []interface{}
+	for _, statement := range statements {
+		for _, resource := range statement.Resources {
+			resources = append(resources, resource)
+		}
+	}
+	return pulumi.All(resources...).ApplyT(func(resolved []interface{}) (string, error) {
+		rendered := make([]map[string]interface{}, len(statements))
+		for i, statement := range statements {
+			arns := make([]string, len(statement.Resources))
+			for j := range arns {
+				arns[j] = resolved[0].(string)
+				resolved = resolved[1:]
+			}
+			rendered[i] = map[string]interface{}{
+				"Sid":      statement.Sid,
+				"Effect":   "Allow",
+				"Action":   statement.Actions,
+				"Resource": arns,
+			}
+		}
+		policy, err := json.Marshal(map[string]interface{}{
+			"Version":   "2012-10-17",
+			"Statement": rendered,
+		})
+		return string(policy), err
+	}).(pulumi.StringOutput)
+}
+
+// logGroupArn returns the ARN that grants access to a CloudWatch Logs group
+// and its streams.
+func logGroupArn(region string, accountId string, name pulumi.StringInput) pulumi.StringOutput {
+	return pulumi.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", region, accountId, name)
+}
@@ -0,0 +1,20 @@
+// Package infra contains the reusable Pulumi components that make up the
+// assessment application stack. Each component is a pulumi.ComponentResource
+// with its own Args struct and exported outputs so that other Go programs can
+// compose them without copying the resource definitions.
+package infra
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// childOptions returns the resource options used for every resource registered
+// under a component. The NoParent alias keeps the URNs of stacks created before
+// the resources were grouped into components, so existing deployments are not
+// replaced.
+func childOptions(parent pulumi.Resource, opts ...pulumi.ResourceOption) []pulumi.ResourceOption {
+	return append([]pulumi.ResourceOption{
+		pulumi.Parent(parent),
+		pulumi.Aliases([]pulumi.Alias{{NoParent: pulumi.Bool(true)}}),
+	}, opts...)
+}
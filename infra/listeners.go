@@ -0,0 +1,125 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Listener describes one port of the application load balancer. The load
+// balancer security group opens exactly the ports of its listeners.
+type Listener struct {
+	Port int `json:"port"`
+	// Protocol is HTTP or HTTPS.
+	Protocol string `json:"protocol"`
+	// Certificate is the domain of an issued ACM certificate, or the ARN of
+	// a certificate, served by an HTTPS listener. Defaults to the domain of
+	// the application.
+	Certificate string `json:"certificate,omitempty"`
+	// AdditionalCertificates are served next to Certificate to clients that
+	// ask for their domain through SNI. Like Certificate, each is a domain
+	// or an ARN.
+	AdditionalCertificates []string `json:"additionalCertificates,omitempty"`
+	// SslPolicy is the TLS security policy of an HTTPS listener. Defaults to
+	// the stack's policy, or the AWS default.
+	SslPolicy string `json:"sslPolicy,omitempty"`
+	// Action is what the listener does with requests: forward them to the
+	// application (the default), redirect them to the HTTPS listener or
+	// answer with a fixed 404 response.
+	Action string `json:"action,omitempty"`
+}
+
+const (
+	// ListenerForward forwards requests to the application instances.
+	ListenerForward = "forward"
+	// ListenerFixedResponse answers every request with a 404.
+	ListenerFixedResponse = "fixed-response"
+	// ListenerRedirect permanently redirects every request to the first
+	// HTTPS listener.
+	ListenerRedirect = "redirect"
+)
+
+// listenerProtocols and listenerActions are the values a Listener accepts.
+var (
+	listenerProtocols = []string{"HTTP", "HTTPS"}
+	listenerActions   = []string{ListenerForward, ListenerFixedResponse, ListenerRedirect}
+)
+
+// DefaultListeners are used when the stack does not configure any: HTTPS on
+// 443 forwarded to the application.
+var DefaultListeners = []Listener{
+	{Port: 443, Protocol: "HTTPS"},
+}
+
+// action returns the action of the listener, defaulting to forward.
+func (l Listener) action() string {
+	if l.Action == "" {
+		return ListenerForward
+	}
+	return l.Action
+}
+
+// WithHttpRedirect adds an HTTP listener on port 80 that redirects to HTTPS
+// when there is an HTTPS listener and nothing listens on port 80 yet.
+func WithHttpRedirect(listeners []Listener) []Listener {
+	if httpsListener(listeners) == nil || slices.Contains(ListenerPorts(listeners), 80) {
+		return listeners
+	}
+	return append(slices.Clone(listeners), Listener{Port: 80, Protocol: "HTTP", Action: ListenerRedirect})
+}
+
+// httpsListener returns the first HTTPS listener, which redirects go to.
+func httpsListener(listeners []Listener) *Listener {
+	for i := range listeners {
+		if listeners[i].Protocol == "HTTPS" {
+			return &listeners[i]
+		}
+	}
+	return nil
+}
+
+// ListenerPorts returns the ports of the listeners, in order.
+func ListenerPorts(listeners []Listener) []int {
+	ports := make([]int, len(listeners))
+	for i, listener := range listeners {
+		ports[i] = listener.Port
+	}
+	return ports
+}
+
+// ValidateListeners reports every listener that has an invalid port,
+// protocol or action, a certificate it cannot use, or the same port as
+// another listener.
+func ValidateListeners(listeners []Listener) error {
+	var errs []error
+	if len(listeners) == 0 {
+		errs = append(errs, fmt.Errorf("at least one listener is required"))
+	}
+	seen := map[int]bool{}
+	for _, listener := range listeners {
+		if listener.Port < 1 || listener.Port > 65535 {
+			errs = append(errs, fmt.Errorf("listener port %d is outside 1-65535", listener.Port))
+		}
+		if seen[listener.Port] {
+			errs = append(errs, fmt.Errorf("port %d has more than one listener", listener.Port))
+		}
+		seen[listener.Port] = true
+		if !slices.Contains(listenerProtocols, listener.Protocol) {
+			errs = append(errs, fmt.Errorf("listener on port %d has protocol %q, want one of %s", listener.Port, listener.Protocol, strings.Join(listenerProtocols, ", ")))
+		}
+		if listener.Protocol == "HTTP" && (listener.Certificate != "" || len(listener.AdditionalCertificates) > 0 || listener.SslPolicy != "") {
+			errs = append(errs, fmt.Errorf("HTTP listener on port %d cannot serve a certificate or TLS policy", listener.Port))
+		}
+		if listener.SslPolicy != "" && !strings.HasPrefix(listener.SslPolicy, "ELBSecurityPolicy-") {
+			errs = append(errs, fmt.Errorf("listener on port %d has TLS policy %q, which is not an ELBSecurityPolicy", listener.Port, listener.SslPolicy))
+		}
+		if listener.action() == ListenerRedirect && (listener.Protocol == "HTTPS" || httpsListener(listeners) == nil) {
+			errs = append(errs, fmt.Errorf("listener on port %d can only redirect from HTTP to an HTTPS listener", listener.Port))
+		}
+		if !slices.Contains(listenerActions, listener.action()) {
+			errs = append(errs, fmt.Errorf("listener on port %d has action %q, want one of %s", listener.Port, listener.Action, strings.Join(listenerActions, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
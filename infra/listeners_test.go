@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateListeners(t *testing.T) {
+	if err := ValidateListeners(DefaultListeners); err != nil {
+		t.Errorf("default listeners are invalid: %v", err)
+	}
+
+	err := ValidateListeners([]Listener{
+		{Port: 443, Protocol: "HTTPS"},
+		{Port: 443, Protocol: "HTTPS", Certificate: "admin.example.com"},
+		{Port: 80, Protocol: "HTTP", Certificate: "example.com"},
+		{Port: 70000, Protocol: "TCP", Action: "drop"},
+	})
+	if err == nil {
+		t.Fatalf("expected invalid listeners to fail")
+	}
+	for _, want := range []string{
+		"port 443 has more than one listener",
+		"HTTP listener on port 80 cannot serve a certificate or TLS policy",
+		"listener port 70000 is outside 1-65535",
+		`listener on port 70000 has protocol "TCP"`,
+		`listener on port 70000 has action "drop"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestWithHttpRedirect(t *testing.T) {
+	listeners := WithHttpRedirect(DefaultListeners)
+	if len(listeners) != 2 || listeners[1].Port != 80 || listeners[1].Protocol != "HTTP" || listeners[1].Action != ListenerRedirect {
+		t.Errorf("listeners = %v, want a redirect on port 80 after the defaults", listeners)
+	}
+	if len(DefaultListeners) != 1 {
+		t.Errorf("WithHttpRedirect changed DefaultListeners to %v", DefaultListeners)
+	}
+	if err := ValidateListeners(listeners); err != nil {
+		t.Errorf("redirect listeners are invalid: %v", err)
+	}
+
+	custom := []Listener{{Port: 443, Protocol: "HTTPS"}, {Port: 80, Protocol: "HTTP", Action: ListenerFixedResponse}}
+	if got := WithHttpRedirect(custom); len(got) != 2 || got[1].Action != ListenerFixedResponse {
+		t.Errorf("listeners = %v, want the configured port 80 listener kept", got)
+	}
+	if got := WithHttpRedirect([]Listener{{Port: 8080, Protocol: "HTTP"}}); len(got) != 1 {
+		t.Errorf("listeners = %v, want no redirect without an HTTPS listener", got)
+	}
+}
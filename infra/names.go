@@ -0,0 +1,651 @@
+package infra
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultNamePattern is the pattern of the resources that have no legacy
+// name when the stack does not set one.
+const DefaultNamePattern = "{project}-{stack}-{component}"
+
+// indexPlaceholder marks where the index of a resource created once per
+// availability zone goes. It is kept in the names of indexed resources and
+// filled in by NameTags.Indexed.
+const indexPlaceholder = "{index}"
+
+// NameTags holds the logical name and Name tag of every resource in the stack.
+// Use NewNameTags to derive it from a naming pattern.
+type NameTags struct {
+	VpcName                           string
+	InternetGatewayName               string
+	PublicSubnetName                  string
+	PrivateSubnetName                 string
+	PublicRouteTableName              string
+	PrivateRouteTableName             string
+	PublicRouteName                   string
+	PublicIpv6RouteName               string
+	EgressOnlyGatewayName             string
+	PrivateIpv6RouteName              string
+	PublicRTAName                     string
+	PrivateRTAName                    string
+	PrivateZoneRouteTableName         string
+	PrivateNatRouteName               string
+	NatEipName                        string
+	NatGatewayName                    string
+	NatSecurityGroupName              string
+	NatInstanceName                   string
+	SecurityGroupName                 string
+	DatabaseSecurityGroupName         string
+	DatabaseSubnetGroupName           string
+	DatabaseParameterGroupName        string
+	DatabaseInstanceName              string
+	DatabasePasswordName              string
+	DatabaseSecretName                string
+	DatabaseSecretVersionName         string
+	DatabaseSecretPolicyName          string
+	DatabaseOptionGroupName           string
+	DatabaseClusterName               string
+	DatabaseClusterInstanceName       string
+	DatabaseClusterParameterGroupName string
+	DatabaseFinalSnapshotName         string
+	DatabaseMonitoringRoleName        string
+	DatabaseMonitoringPolicyName      string
+	ApplicationInstanceName           string
+	CloudwatchAgentRoleName           string
+	CloudwatchInstanceProfileName     string
+	CloudwatchAgentPolicyName         string
+	SnsPolicyName                     string
+	ApplicationLogGroupName           string
+	SessionManagerPolicyName          string
+	SessionLogGroupName               string
+	SessionPreferencesName            string
+	ApplicationInstanceRecordName     string
+	AliasRecordName                   string
+	ApplicationInstanceIpv6RecordName string
+	AliasIpv6RecordName               string
+	HostedZoneName                    string
+	ZoneDelegationName                string
+	ApplicationDatabaseEgressName     string
+	ApplicationCloudwatchEgressName   string
+	LoadBalancerSecurityGroupName     string
+	LoadBalancerEgressName            string
+	VpcEndpointSecurityGroupName      string
+	ApplicationEndpointEgressName     string
+	TargetGroupName                   string
+	Ec2LaunchTemplateName             string
+	LoadBalancerName                  string
+	ListenerName                      string
+	CertificateName                   string
+	CertificateValidationRecordName   string
+	CertificateValidationName         string
+	AutoScalingGroupName              string
+	ScaleUpPolicyName                 string
+	ScaleDownPolicyName               string
+	ScaleUpAlarmName                  string
+	ScaleDownAlarmName                string
+	DynamoDBName                      string
+	DynamoDBPolicyName                string
+	BucketName                        string
+	BucketBindingName                 string
+	TopicName                         string
+	LambdaRoleName                    string
+	LambdaLogsPolicyName              string
+	LambdaFunctionName                string
+	LambdaFunctionPermissionName      string
+	LambdaSubscriptionName            string
+	LambdaSecretsPolicyName           string
+	SmtpKeySecretName                 string
+	SmtpKeySecretVersionName          string
+	GcpKeySecretName                  string
+	GcpKeySecretVersionName           string
+	ServiceAccountName                string
+	ServiceAccountId                  string
+	ServiceAccountKeyName             string
+
+	// naming is kept to derive the names of components that depend on the
+	// configuration, such as the subnets of additional tiers.
+	naming NamingArgs
+}
+
+// Indexed returns the name of the index-th copy of a resource created once
+// per availability zone, e.g. names.Indexed(names.PublicSubnetName, 1).
+func (n NameTags) Indexed(name string, index int) string {
+	return strings.ReplaceAll(name, indexPlaceholder, strconv.Itoa(index))
+}
+
+// SubnetName returns the indexed name of the subnets of a tier. The public
+// and private tiers keep their own, overridable names.
+func (n NameTags) SubnetName(tier string) (string, error) {
+	switch tier {
+	case "public":
+		return n.PublicSubnetName, nil
+	case "private":
+		return n.PrivateSubnetName, nil
+	}
+	return n.derive(tier+"-subnet", true)
+}
+
+// RouteTableAssociationName returns the indexed name of the route table
+// associations of the subnets of a tier.
+func (n NameTags) RouteTableAssociationName(tier string) (string, error) {
+	switch tier {
+	case "public":
+		return n.PublicRTAName, nil
+	case "private":
+		return n.PrivateRTAName, nil
+	}
+	return n.derive(tier+"-rta", true)
+}
+
+// ListenerPortName returns the name of the load balancer listener on a
+// port. The HTTPS listener on 443 keeps the overridable listener name.
+func (n NameTags) ListenerPortName(port int) (string, error) {
+	if port == 443 {
+		return n.ListenerName, nil
+	}
+	return n.derive(fmt.Sprintf("listener-%d", port), false)
+}
+
+// ListenerCertificateName returns the indexed name of the additional
+// certificates of the listener on a port.
+func (n NameTags) ListenerCertificateName(port int) (string, error) {
+	return n.derive(fmt.Sprintf("listener-%d-certificate", port), true)
+}
+
+// VpcEndpointName returns the name of the VPC endpoint of an AWS service,
+// e.g. logs or dynamodb.
+func (n NameTags) VpcEndpointName(service string) (string, error) {
+	return n.derive(service+"-endpoint", false)
+}
+
+// EndpointEgressName returns the name of the rule that lets the application
+// reach the gateway endpoint of an AWS service.
+func (n NameTags) EndpointEgressName(service string) (string, error) {
+	return n.derive("application-"+service+"-egress", false)
+}
+
+// derive expands the naming pattern for a component that has no entry in
+// nameSpecs, such as the subnets of an additional tier.
+func (n NameTags) derive(component string, indexed bool) (string, error) {
+	spec := nameSpec{component: component, kind: tagName, indexed: indexed}
+	return spec.name(n.naming.Pattern, NamingArgs{Project: n.naming.Project, Stack: n.naming.Stack}, false)
+}
+
+// NamingArgs configures how resource names are derived.
+type NamingArgs struct {
+	// Pattern is expanded for every resource. It may use {project}, {stack},
+	// {component} and {index}. When it is empty, the resources deployed
+	// before naming patterns keep their legacyNames, so that their URNs do
+	// not change, and the others use DefaultNamePattern.
+	Pattern string
+	Project string
+	Stack   string
+	// Overrides replaces the derived name of a component, keyed by component,
+	// e.g. {"bucket": "my-bucket"}. Overrides are used verbatim, so they must
+	// already satisfy the limits of the resource.
+	Overrides map[string]string
+}
+
+// nameKind describes the limits a provider puts on a resource name.
+type nameKind struct {
+	description string
+	minLength   int
+	// maxLength is the longest name accepted. Zero means unlimited.
+	maxLength int
+	// autoNamed resources get a random suffix of autoNameSuffix characters
+	// from Pulumi, which counts against maxLength.
+	autoNamed bool
+	lowercase bool
+	charset   *regexp.Regexp
+}
+
+// autoNameSuffix is the length of the "-xxxxxxx" suffix Pulumi appends to
+// auto-named resources.
+const autoNameSuffix = 8
+
+var (
+	logicalName = nameKind{
+		description: "resource name",
+		minLength:   1,
+		charset:     regexp.MustCompile(`^[^:]+$`),
+	}
+	tagName = nameKind{
+		description: "Name tag",
+		minLength:   1,
+		maxLength:   256,
+		charset:     regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]+$`),
+	}
+	securityGroupName = nameKind{
+		description: "security group name",
+		minLength:   1,
+		maxLength:   255,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9 ._\-:/()#,@\[\]+=&;{}!$*]+$`),
+	}
+	rdsName = nameKind{
+		description: "RDS name",
+		minLength:   1,
+		maxLength:   255,
+		autoNamed:   true,
+		lowercase:   true,
+		charset:     regexp.MustCompile(`^[a-z][a-z0-9-]*$`),
+	}
+	rdsIdentifier = nameKind{
+		description: "RDS instance identifier",
+		minLength:   1,
+		maxLength:   63,
+		autoNamed:   true,
+		lowercase:   true,
+		charset:     regexp.MustCompile(`^[a-z][a-z0-9-]*$`),
+	}
+	// rdsSnapshotIdentifier names the final snapshot RDS takes when it
+	// deletes the instance, which Pulumi does not auto-name.
+	rdsSnapshotIdentifier = nameKind{
+		description: "RDS snapshot identifier",
+		minLength:   1,
+		maxLength:   255,
+		lowercase:   true,
+		charset:     regexp.MustCompile(`^[a-z][a-z0-9-]*$`),
+	}
+	iamRoleName = nameKind{
+		description: "IAM role name",
+		minLength:   1,
+		maxLength:   64,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[\w+=,.@-]+$`),
+	}
+	iamName = nameKind{
+		description: "IAM policy or instance profile name",
+		minLength:   1,
+		maxLength:   128,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[\w+=,.@-]+$`),
+	}
+	secretName = nameKind{
+		description: "secret name",
+		minLength:   1,
+		maxLength:   512,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[\w/+=.@-]+$`),
+	}
+	logGroupName = nameKind{
+		description: "log group name",
+		minLength:   1,
+		maxLength:   512,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9_\-/.#]+$`),
+	}
+	ssmDocumentName = nameKind{
+		description: "SSM document name",
+		minLength:   3,
+		maxLength:   128,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`),
+	}
+	launchTemplateName = nameKind{
+		description: "launch template name",
+		minLength:   3,
+		maxLength:   128,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9().\-/_]+$`),
+	}
+	autoScalingName = nameKind{
+		description: "auto scaling name",
+		minLength:   1,
+		maxLength:   255,
+		charset:     regexp.MustCompile(`^[^:]+$`),
+	}
+	loadBalancerName = nameKind{
+		description: "load balancer or target group name",
+		minLength:   1,
+		maxLength:   32,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`),
+	}
+	topicName = nameKind{
+		description: "SNS topic name",
+		minLength:   1,
+		maxLength:   256,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9_-]+$`),
+	}
+	tableName = nameKind{
+		description: "DynamoDB table name",
+		minLength:   3,
+		maxLength:   255,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`),
+	}
+	lambdaName = nameKind{
+		description: "Lambda function name",
+		minLength:   1,
+		maxLength:   64,
+		autoNamed:   true,
+		charset:     regexp.MustCompile(`^[a-zA-Z0-9_-]+$`),
+	}
+	bucketName = nameKind{
+		description: "bucket name",
+		minLength:   3,
+		maxLength:   63,
+		lowercase:   true,
+		charset:     regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*[a-z0-9]$`),
+	}
+	serviceAccountDisplayName = nameKind{
+		description: "service account display name",
+		minLength:   1,
+		maxLength:   100,
+		charset:     regexp.MustCompile(`^[^:]+$`),
+	}
+	serviceAccountId = nameKind{
+		description: "service account id",
+		minLength:   6,
+		maxLength:   30,
+		lowercase:   true,
+		charset:     regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$`),
+	}
+)
+
+// nameSpec ties a NameTags field to the component it is derived from, the
+// limits of the resource and the resource type it names.
+type nameSpec struct {
+	component string
+	kind      nameKind
+	// resourceType is the Pulumi type the name is the logical name of. Two
+	// names of the same type must not collide. Empty for names that are only
+	// used as a physical name or tag.
+	resourceType string
+	// indexed names keep the {index} placeholder for NameTags.Indexed.
+	indexed bool
+	field   func(*NameTags) *string
+}
+
+var nameSpecs = []nameSpec{
+	{"vpc", tagName, "aws:ec2/vpc:Vpc", false, func(n *NameTags) *string { return &n.VpcName }},
+	{"internet-gateway", tagName, "aws:ec2/internetGateway:InternetGateway", false, func(n *NameTags) *string { return &n.InternetGatewayName }},
+	{"public-subnet", tagName, "aws:ec2/subnet:Subnet", true, func(n *NameTags) *string { return &n.PublicSubnetName }},
+	{"private-subnet", tagName, "aws:ec2/subnet:Subnet", true, func(n *NameTags) *string { return &n.PrivateSubnetName }},
+	{"public-route-table", tagName, "aws:ec2/routeTable:RouteTable", false, func(n *NameTags) *string { return &n.PublicRouteTableName }},
+	{"private-route-table", tagName, "aws:ec2/routeTable:RouteTable", false, func(n *NameTags) *string { return &n.PrivateRouteTableName }},
+	{"public-route", logicalName, "aws:ec2/route:Route", false, func(n *NameTags) *string { return &n.PublicRouteName }},
+	{"public-ipv6-route", logicalName, "aws:ec2/route:Route", false, func(n *NameTags) *string { return &n.PublicIpv6RouteName }},
+	{"egress-only-gateway", tagName, "aws:ec2/egressOnlyInternetGateway:EgressOnlyInternetGateway", false, func(n *NameTags) *string { return &n.EgressOnlyGatewayName }},
+	{"private-ipv6-route", logicalName, "aws:ec2/route:Route", true, func(n *NameTags) *string { return &n.PrivateIpv6RouteName }},
+	{"public-rta", logicalName, "aws:ec2/routeTableAssociation:RouteTableAssociation", true, func(n *NameTags) *string { return &n.PublicRTAName }},
+	{"private-rta", logicalName, "aws:ec2/routeTableAssociation:RouteTableAssociation", true, func(n *NameTags) *string { return &n.PrivateRTAName }},
+	{"private-zone-route-table", tagName, "aws:ec2/routeTable:RouteTable", true, func(n *NameTags) *string { return &n.PrivateZoneRouteTableName }},
+	{"private-nat-route", logicalName, "aws:ec2/route:Route", true, func(n *NameTags) *string { return &n.PrivateNatRouteName }},
+	{"nat-eip", tagName, "aws:ec2/eip:Eip", true, func(n *NameTags) *string { return &n.NatEipName }},
+	{"nat-gateway", tagName, "aws:ec2/natGateway:NatGateway", true, func(n *NameTags) *string { return &n.NatGatewayName }},
+	{"nat-security-group", securityGroupName, "aws:ec2/securityGroup:SecurityGroup", false, func(n *NameTags) *string { return &n.NatSecurityGroupName }},
+	{"nat-instance", tagName, "aws:ec2/instance:Instance", false, func(n *NameTags) *string { return &n.NatInstanceName }},
+	{"application-security-group", securityGroupName, "aws:ec2/securityGroup:SecurityGroup", false, func(n *NameTags) *string { return &n.SecurityGroupName }},
+	{"database-security-group", securityGroupName, "aws:ec2/securityGroup:SecurityGroup", false, func(n *NameTags) *string { return &n.DatabaseSecurityGroupName }},
+	{"load-balancer-security-group", securityGroupName, "aws:ec2/securityGroup:SecurityGroup", false, func(n *NameTags) *string { return &n.LoadBalancerSecurityGroupName }},
+	{"application-database-egress", logicalName, "aws:ec2/securityGroupRule:SecurityGroupRule", false, func(n *NameTags) *string { return &n.ApplicationDatabaseEgressName }},
+	{"application-cloudwatch-egress", logicalName, "aws:ec2/securityGroupRule:SecurityGroupRule", false, func(n *NameTags) *string { return &n.ApplicationCloudwatchEgressName }},
+	{"load-balancer-egress", logicalName, "aws:ec2/securityGroupRule:SecurityGroupRule", false, func(n *NameTags) *string { return &n.LoadBalancerEgressName }},
+	{"vpc-endpoint-security-group", securityGroupName, "aws:ec2/securityGroup:SecurityGroup", false, func(n *NameTags) *string { return &n.VpcEndpointSecurityGroupName }},
+	{"application-endpoint-egress", logicalName, "aws:ec2/securityGroupRule:SecurityGroupRule", false, func(n *NameTags) *string { return &n.ApplicationEndpointEgressName }},
+	{"database-subnet-group", rdsName, "aws:rds/subnetGroup:SubnetGroup", false, func(n *NameTags) *string { return &n.DatabaseSubnetGroupName }},
+	{"database-parameter-group", rdsName, "aws:rds/parameterGroup:ParameterGroup", false, func(n *NameTags) *string { return &n.DatabaseParameterGroupName }},
+	{"database", rdsIdentifier, "aws:rds/instance:Instance", false, func(n *NameTags) *string { return &n.DatabaseInstanceName }},
+	{"database-password", logicalName, "random:index/randomPassword:RandomPassword", false, func(n *NameTags) *string { return &n.DatabasePasswordName }},
+	{"database-secret", secretName, "aws:secretsmanager/secret:Secret", false, func(n *NameTags) *string { return &n.DatabaseSecretName }},
+	{"database-secret-version", logicalName, "aws:secretsmanager/secretVersion:SecretVersion", false, func(n *NameTags) *string { return &n.DatabaseSecretVersionName }},
+	{"database-secret-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.DatabaseSecretPolicyName }},
+	{"database-option-group", rdsName, "aws:rds/optionGroup:OptionGroup", false, func(n *NameTags) *string { return &n.DatabaseOptionGroupName }},
+	{"database-cluster", rdsIdentifier, "aws:rds/cluster:Cluster", false, func(n *NameTags) *string { return &n.DatabaseClusterName }},
+	{"aurora-instance", rdsIdentifier, "aws:rds/clusterInstance:ClusterInstance", true, func(n *NameTags) *string { return &n.DatabaseClusterInstanceName }},
+	{"database-cluster-parameter-group", rdsName, "aws:rds/clusterParameterGroup:ClusterParameterGroup", false, func(n *NameTags) *string { return &n.DatabaseClusterParameterGroupName }},
+	{"database-final-snapshot", rdsSnapshotIdentifier, "", false, func(n *NameTags) *string { return &n.DatabaseFinalSnapshotName }},
+	{"database-monitoring-role", iamRoleName, "aws:iam/role:Role", false, func(n *NameTags) *string { return &n.DatabaseMonitoringRoleName }},
+	{"database-monitoring-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.DatabaseMonitoringPolicyName }},
+	{"application-instance", tagName, "", false, func(n *NameTags) *string { return &n.ApplicationInstanceName }},
+	{"cloudwatch-agent-role", iamRoleName, "aws:iam/role:Role", false, func(n *NameTags) *string { return &n.CloudwatchAgentRoleName }},
+	{"cloudwatch-instance-profile", iamName, "aws:iam/instanceProfile:InstanceProfile", false, func(n *NameTags) *string { return &n.CloudwatchInstanceProfileName }},
+	{"cloudwatch-agent-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.CloudwatchAgentPolicyName }},
+	{"application-log-group", logGroupName, "aws:cloudwatch/logGroup:LogGroup", false, func(n *NameTags) *string { return &n.ApplicationLogGroupName }},
+	{"session-manager-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.SessionManagerPolicyName }},
+	{"session-log-group", logGroupName, "aws:cloudwatch/logGroup:LogGroup", false, func(n *NameTags) *string { return &n.SessionLogGroupName }},
+	{"session-preferences", ssmDocumentName, "aws:ssm/document:Document", false, func(n *NameTags) *string { return &n.SessionPreferencesName }},
+	{"sns-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.SnsPolicyName }},
+	{"application-record", logicalName, "aws:route53/record:Record", false, func(n *NameTags) *string { return &n.ApplicationInstanceRecordName }},
+	{"alias-record", logicalName, "aws:route53/record:Record", true, func(n *NameTags) *string { return &n.AliasRecordName }},
+	{"application-ipv6-record", logicalName, "aws:route53/record:Record", false, func(n *NameTags) *string { return &n.ApplicationInstanceIpv6RecordName }},
+	{"alias-ipv6-record", logicalName, "aws:route53/record:Record", true, func(n *NameTags) *string { return &n.AliasIpv6RecordName }},
+	{"hosted-zone", tagName, "aws:route53/zone:Zone", false, func(n *NameTags) *string { return &n.HostedZoneName }},
+	{"zone-delegation", logicalName, "aws:route53/record:Record", false, func(n *NameTags) *string { return &n.ZoneDelegationName }},
+	{"launch-template", launchTemplateName, "aws:ec2/launchTemplate:LaunchTemplate", false, func(n *NameTags) *string { return &n.Ec2LaunchTemplateName }},
+	{"target-group", loadBalancerName, "aws:alb/targetGroup:TargetGroup", false, func(n *NameTags) *string { return &n.TargetGroupName }},
+	{"load-balancer", loadBalancerName, "aws:lb/loadBalancer:LoadBalancer", false, func(n *NameTags) *string { return &n.LoadBalancerName }},
+	{"listener", logicalName, "aws:alb/listener:Listener", false, func(n *NameTags) *string { return &n.ListenerName }},
+	{"certificate", tagName, "aws:acm/certificate:Certificate", false, func(n *NameTags) *string { return &n.CertificateName }},
+	{"certificate-validation-record", logicalName, "aws:route53/record:Record", true, func(n *NameTags) *string { return &n.CertificateValidationRecordName }},
+	{"certificate-validation", logicalName, "aws:acm/certificateValidation:CertificateValidation", false, func(n *NameTags) *string { return &n.CertificateValidationName }},
+	{"auto-scaling-group", autoScalingName, "aws:autoscaling/group:Group", false, func(n *NameTags) *string { return &n.AutoScalingGroupName }},
+	{"scale-up-policy", autoScalingName, "aws:autoscaling/policy:Policy", false, func(n *NameTags) *string { return &n.ScaleUpPolicyName }},
+	{"scale-down-policy", autoScalingName, "aws:autoscaling/policy:Policy", false, func(n *NameTags) *string { return &n.ScaleDownPolicyName }},
+	{"scale-up-alarm", autoScalingName, "aws:cloudwatch/metricAlarm:MetricAlarm", false, func(n *NameTags) *string { return &n.ScaleUpAlarmName }},
+	{"scale-down-alarm", autoScalingName, "aws:cloudwatch/metricAlarm:MetricAlarm", false, func(n *NameTags) *string { return &n.ScaleDownAlarmName }},
+	{"submission-table", tableName, "aws:dynamodb/table:Table", false, func(n *NameTags) *string { return &n.DynamoDBName }},
+	{"dynamodb-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.DynamoDBPolicyName }},
+	{"submission-topic", topicName, "aws:sns/topic:Topic", false, func(n *NameTags) *string { return &n.TopicName }},
+	{"lambda-role", iamRoleName, "aws:iam/role:Role", false, func(n *NameTags) *string { return &n.LambdaRoleName }},
+	{"lambda-logs-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.LambdaLogsPolicyName }},
+	{"submission-lambda", lambdaName, "aws:lambda/function:Function", false, func(n *NameTags) *string { return &n.LambdaFunctionName }},
+	{"lambda-permission", logicalName, "aws:lambda/permission:Permission", false, func(n *NameTags) *string { return &n.LambdaFunctionPermissionName }},
+	{"lambda-subscription", logicalName, "aws:sns/topicSubscription:TopicSubscription", false, func(n *NameTags) *string { return &n.LambdaSubscriptionName }},
+	{"lambda-secrets-policy", iamName, "aws:iam/rolePolicy:RolePolicy", false, func(n *NameTags) *string { return &n.LambdaSecretsPolicyName }},
+	{"smtp-key-secret", secretName, "aws:secretsmanager/secret:Secret", false, func(n *NameTags) *string { return &n.SmtpKeySecretName }},
+	{"smtp-key-secret-version", logicalName, "aws:secretsmanager/secretVersion:SecretVersion", false, func(n *NameTags) *string { return &n.SmtpKeySecretVersionName }},
+	{"gcp-key-secret", secretName, "aws:secretsmanager/secret:Secret", false, func(n *NameTags) *string { return &n.GcpKeySecretName }},
+	{"gcp-key-secret-version", logicalName, "aws:secretsmanager/secretVersion:SecretVersion", false, func(n *NameTags) *string { return &n.GcpKeySecretVersionName }},
+	{"bucket", bucketName, "gcp:storage/bucket:Bucket", false, func(n *NameTags) *string { return &n.BucketName }},
+	{"bucket-binding", logicalName, "gcp:storage/bucketIAMMember:BucketIAMMember", false, func(n *NameTags) *string { return &n.BucketBindingName }},
+	{"service-account", serviceAccountDisplayName, "gcp:serviceAccount/account:Account", false, func(n *NameTags) *string { return &n.ServiceAccountName }},
+	{"service-account-id", serviceAccountId, "", false, func(n *NameTags) *string { return &n.ServiceAccountId }},
+	{"service-account-key", logicalName, "gcp:serviceAccount/key:Key", false, func(n *NameTags) *string { return &n.ServiceAccountKeyName }},
+}
+
+// legacyName is the name a component had before naming patterns, and the
+// config key that used to override it.
+type legacyName struct {
+	key  string
+	name string
+}
+
+// legacyNames are the names of the resources deployed before naming
+// patterns, by component. Indexed names get their index appended.
+var legacyNames = map[string]legacyName{
+	"vpc":                           {"vpcName", "my-vpc"},
+	"internet-gateway":              {"internetGatewayName", "Internet-Gateway"},
+	"public-subnet":                 {"publicSubnetName", "public-subnet"},
+	"private-subnet":                {"privateSubnetName", "private-subnet"},
+	"public-route-table":            {"publicRouteTableName", "public-route-table"},
+	"private-route-table":           {"privateRouteTableName", "private-route-table"},
+	"public-route":                  {"", "public-route"},
+	"public-rta":                    {"publicRTAName", "publicRTA"},
+	"private-rta":                   {"privateRTAName", "privateRTA"},
+	"application-security-group":    {"securityGroupName", "application-security-group"},
+	"database-security-group":       {"databaseSecurityGroupName", "database-security-group"},
+	"load-balancer-security-group":  {"loadBalancerSecurityGroupName", "load-balancer-security-group"},
+	"application-database-egress":   {"applicationDatabaseEgressName", "application-database-egress"},
+	"application-cloudwatch-egress": {"applicationCloudwatchEgressName", "application-cloudwatch-egress"},
+	"load-balancer-egress":          {"", "loadBalancer-a-egress"},
+	"database-subnet-group":         {"databaseSubnetGroupName", "database-subnet-group"},
+	"database-parameter-group":      {"databaseParameterGroupName", "database-parameter-group"},
+	"database":                      {"databaseInstanceName", "assessment-application-database"},
+	"application-instance":          {"applicationInstanceName", "assessment-application-instance"},
+	"cloudwatch-agent-role":         {"cloudwatchAgentRoleName", "cloudwatch-agent-role"},
+	"cloudwatch-instance-profile":   {"cloudwatchInstanceProfileName", "cloudwatch-instance-profile"},
+	"cloudwatch-agent-policy":       {"cloudwatchAgentPolicyName", "cloudwatch-agent-policy"},
+	"application-record":            {"applicationInstanceRecordName", "application-instance-record"},
+	"launch-template":               {"ec2LaunchTemplateName", "csye6225_asg"},
+	"target-group":                  {"targetGroupName", "target-group"},
+	"load-balancer":                 {"loadBalancerName", "load-balancer"},
+	"listener":                      {"listenerName", "listener"},
+	"auto-scaling-group":            {"autoScalingGroupName", "auto-scaling-group"},
+	"scale-up-policy":               {"scaleUpPolicyName", "scale-up-policy"},
+	"scale-down-policy":             {"scaleDownPolicyName", "scale-down-policy"},
+	"scale-up-alarm":                {"scaleUpAlarmName", "scale-up-alarm"},
+	"scale-down-alarm":              {"scaleDownAlarmName", "scale-down-alarm"},
+	"submission-table":              {"dynamoDBName", "Submission-table"},
+	"dynamodb-policy":               {"dynamoDBPolicyName", "dynamodb-policy"},
+	"submission-topic":              {"topicName", "assessment-application-topic"},
+	"lambda-role":                   {"", "lambdaRole"},
+	"submission-lambda":             {"lambdaFunctionName", "assessment-application-lambda"},
+	"lambda-permission":             {"lambdaFunctionPermissionName", "lambda-function-permission"},
+	"lambda-subscription":           {"", "lambdaSubscription"},
+	"bucket":                        {"bucketName", "pranay-bucket-csye6225"},
+	"bucket-binding":                {"", "My-Bucket-Binding"},
+	"service-account":               {"serviceAccountName", "assessment-application-service-account"},
+	"service-account-id":            {"serviceAccountId", "service-account-id"},
+	"service-account-key":           {"serviceAccountKeyName", "assessment-application-service-account-key"},
+}
+
+// LegacyNameKeys returns the config keys that used to override the name of
+// a component, mapped to the component. They are no longer read.
+func LegacyNameKeys() map[string]string {
+	keys := map[string]string{"dynamoDBPolicyAttachmentName": "dynamodb-policy"}
+	for component, legacy := range legacyNames {
+		if legacy.key != "" {
+			keys[legacy.key] = component
+		}
+	}
+	return keys
+}
+
+// NameComponents returns the component keys that can be overridden, in the
+// order the resources are declared.
+func NameComponents() []string {
+	components := make([]string, len(nameSpecs))
+	for i, spec := range nameSpecs {
+		components[i] = spec.component
+	}
+	return components
+}
+
+// NewNameTags derives the name of every resource from args. Names derived
+// from the pattern are shortened to fit the limits of their resource; an
+// override that breaks a limit, an unknown override and two resources of the
+// same type with the same name are all reported in the returned error.
+func NewNameTags(args NamingArgs) (NameTags, error) {
+	var nameTags NameTags
+	var errs []error
+
+	pattern := args.Pattern
+	legacy := pattern == ""
+	if legacy {
+		pattern = DefaultNamePattern
+	}
+	if !strings.Contains(pattern, "{component}") {
+		return nameTags, fmt.Errorf("naming pattern %q must contain {component}", pattern)
+	}
+
+	var unknown []string
+	for component := range args.Overrides {
+		if !slices.Contains(NameComponents(), component) {
+			unknown = append(unknown, component)
+		}
+	}
+	sort.Strings(unknown)
+	for _, component := range unknown {
+		errs = append(errs, fmt.Errorf("name override %q does not match any resource", component))
+	}
+
+	nameTags.naming = NamingArgs{Pattern: pattern, Project: args.Project, Stack: args.Stack}
+	seen := map[string]string{}
+	for _, spec := range nameSpecs {
+		name, err := spec.name(pattern, args, legacy)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		*spec.field(&nameTags) = name
+
+		if spec.resourceType == "" {
+			continue
+		}
+		key := spec.resourceType + " " + name
+		if other, ok := seen[key]; ok {
+			errs = append(errs, fmt.Errorf("components %q and %q are both named %q", other, spec.component, name))
+			continue
+		}
+		seen[key] = spec.component
+	}
+	return nameTags, errors.Join(errs...)
+}
+
+// name expands the name of one resource and checks it against its limits.
+// With legacy, a resource that has a legacy name keeps it unless it is
+// overridden.
+func (spec nameSpec) name(pattern string, args NamingArgs, legacy bool) (string, error) {
+	name, overridden := args.Overrides[spec.component]
+	if !overridden && legacy {
+		var old legacyName
+		old, overridden = legacyNames[spec.component]
+		name = old.name
+	}
+	if !overridden {
+		name = strings.NewReplacer(
+			"{project}", args.Project,
+			"{stack}", args.Stack,
+			"{component}", spec.component,
+		).Replace(pattern)
+		if spec.kind.lowercase {
+			name = strings.ToLower(name)
+		}
+	}
+	name = placeIndex(name, spec.indexed)
+
+	limit := spec.kind.maxLength
+	if spec.kind.autoNamed && limit > 0 {
+		limit -= autoNameSuffix
+	}
+	// Measure indexed names with the longest index they are given.
+	measured := strings.ReplaceAll(name, indexPlaceholder, "99")
+	if limit > 0 && len(measured) > limit {
+		if overridden || spec.indexed {
+			return "", fmt.Errorf("%s %q of %q is longer than %d characters", spec.kind.description, name, spec.component, limit)
+		}
+		name = shorten(name, limit)
+	}
+	if len(measured) < spec.kind.minLength {
+		return "", fmt.Errorf("%s %q of %q is shorter than %d characters", spec.kind.description, name, spec.component, spec.kind.minLength)
+	}
+	if !spec.kind.charset.MatchString(strings.ReplaceAll(name, indexPlaceholder, "1")) {
+		return "", fmt.Errorf("%s %q of %q must match %s", spec.kind.description, name, spec.component, spec.kind.charset)
+	}
+	return name, nil
+}
+
+// placeIndex keeps the {index} placeholder in indexed names, appending it
+// when the pattern has none, and removes it together with its separator from
+// all other names.
+func placeIndex(name string, indexed bool) string {
+	if indexed {
+		if !strings.Contains(name, indexPlaceholder) {
+			name += "-" + indexPlaceholder
+		}
+		return name
+	}
+	for _, separator := range []string{"-", "_", ".", ""} {
+		name = strings.ReplaceAll(name, separator+indexPlaceholder, "")
+	}
+	return name
+}
+
+// shorten truncates name to limit characters, ending it with a hash of the
+// full name so that two long names sharing a prefix stay distinct.
+func shorten(name string, limit int) string {
+	sum := sha1.Sum([]byte(name))
+	suffix := hex.EncodeToString(sum[:])[:6]
+	prefix := strings.TrimRight(name[:limit-len(suffix)-1], "-_.")
+	return prefix + "-" + suffix
+}
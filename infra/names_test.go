@@ -0,0 +1,139 @@
+package infra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewNameTagsDefaultPattern(t *testing.T) {
+	names, err := NewNameTags(NamingArgs{Pattern: DefaultNamePattern, Project: "iac-pulumi", Stack: "dev"})
+	if err != nil {
+		t.Fatalf("deriving default names: %v", err)
+	}
+	if names.VpcName != "iac-pulumi-dev-vpc" {
+		t.Errorf("VpcName = %q, want iac-pulumi-dev-vpc", names.VpcName)
+	}
+	if got := names.Indexed(names.PublicSubnetName, 2); got != "iac-pulumi-dev-public-subnet-2" {
+		t.Errorf("second public subnet = %q, want iac-pulumi-dev-public-subnet-2", got)
+	}
+	if len(names.ServiceAccountId) > 30 {
+		t.Errorf("ServiceAccountId %q is longer than 30 characters", names.ServiceAccountId)
+	}
+}
+
+func TestNewNameTagsLegacyNames(t *testing.T) {
+	names, err := NewNameTags(NamingArgs{
+		Project:   "iac-pulumi",
+		Stack:     "dev",
+		Overrides: map[string]string{"bucket": "my-bucket"},
+	})
+	if err != nil {
+		t.Fatalf("deriving legacy names: %v", err)
+	}
+	if names.VpcName != "my-vpc" || names.DatabaseInstanceName != "assessment-application-database" {
+		t.Errorf("names = %q %q, want the legacy my-vpc and assessment-application-database", names.VpcName, names.DatabaseInstanceName)
+	}
+	if got := names.Indexed(names.PublicSubnetName, 1); got != "public-subnet-1" {
+		t.Errorf("first public subnet = %q, want public-subnet-1", got)
+	}
+	if names.BucketName != "my-bucket" {
+		t.Errorf("BucketName = %q, want the override my-bucket", names.BucketName)
+	}
+	// Components added after the legacy names use the default pattern
+	if names.DatabaseClusterName != "iac-pulumi-dev-database-cluster" {
+		t.Errorf("DatabaseClusterName = %q, want iac-pulumi-dev-database-cluster", names.DatabaseClusterName)
+	}
+}
+
+func TestNewNameTagsIndexPlaceholder(t *testing.T) {
+	names, err := NewNameTags(NamingArgs{
+		Pattern: "{stack}-{component}-{index}",
+		Project: "iac-pulumi",
+		Stack:   "dev",
+	})
+	if err != nil {
+		t.Fatalf("deriving names: %v", err)
+	}
+	if names.VpcName != "dev-vpc" {
+		t.Errorf("VpcName = %q, want dev-vpc", names.VpcName)
+	}
+	if got := names.Indexed(names.PrivateSubnetName, 3); got != "dev-private-subnet-3" {
+		t.Errorf("third private subnet = %q, want dev-private-subnet-3", got)
+	}
+}
+
+func TestNewNameTagsShortensToProviderLimits(t *testing.T) {
+	names, err := NewNameTags(NamingArgs{
+		Project: "assessment-application",
+		Stack:   "Production",
+	})
+	if err != nil {
+		t.Fatalf("deriving names: %v", err)
+	}
+
+	// Load balancers and target groups are auto-named, so 8 of their 32
+	// characters go to the random suffix.
+	for name, limit := range map[string]int{
+		names.LoadBalancerName: 24,
+		names.TargetGroupName:  24,
+		names.ServiceAccountId: 30,
+		names.LambdaRoleName:   56,
+	} {
+		if len(name) > limit {
+			t.Errorf("%q is longer than %d characters", name, limit)
+		}
+	}
+	if names.LoadBalancerName == names.TargetGroupName {
+		t.Errorf("shortened names collide: %q", names.LoadBalancerName)
+	}
+	if names.BucketName != strings.ToLower(names.BucketName) {
+		t.Errorf("bucket name %q is not lowercase", names.BucketName)
+	}
+}
+
+func TestNewNameTagsOverrides(t *testing.T) {
+	names, err := NewNameTags(NamingArgs{
+		Project:   "iac-pulumi",
+		Stack:     "dev",
+		Overrides: map[string]string{"bucket": "my-submission-bucket"},
+	})
+	if err != nil {
+		t.Fatalf("deriving names: %v", err)
+	}
+	if names.BucketName != "my-submission-bucket" {
+		t.Errorf("BucketName = %q, want the override", names.BucketName)
+	}
+}
+
+func TestNewNameTagsReportsEveryProblem(t *testing.T) {
+	_, err := NewNameTags(NamingArgs{
+		Project: "iac-pulumi",
+		Stack:   "dev",
+		Overrides: map[string]string{
+			"bucket":                       "My_Bucket",
+			"load-balancer":                "a-load-balancer-name-that-is-too-long",
+			"database-security-group":      "shared",
+			"load-balancer-security-group": "shared",
+			"not-a-component":              "x",
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected invalid overrides to fail")
+	}
+	for _, want := range []string{
+		`bucket name "My_Bucket" of "bucket" must match`,
+		`"load-balancer" is longer than 24 characters`,
+		`components "database-security-group" and "load-balancer-security-group" are both named "shared"`,
+		`name override "not-a-component" does not match any resource`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestNewNameTagsRequiresComponent(t *testing.T) {
+	if _, err := NewNameTags(NamingArgs{Pattern: "{project}-{stack}"}); err == nil {
+		t.Errorf("expected a pattern without {component} to fail")
+	}
+}
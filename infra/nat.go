@@ -0,0 +1,213 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NatMode selects how private subnets reach the internet.
+type NatMode string
+
+const (
+	// NatNone gives private subnets no outbound path.
+	NatNone NatMode = "none"
+	// NatSingle shares one NAT gateway in the first zone between all zones.
+	NatSingle NatMode = "single"
+	// NatPerZone creates a NAT gateway and a private route table per zone, so
+	// that losing a zone does not cut the egress of the others.
+	NatPerZone NatMode = "per-az"
+	// NatInstance routes every zone through a small EC2 instance, which is
+	// cheaper than a NAT gateway for development stacks.
+	NatInstance NatMode = "instance"
+)
+
+// NatModes lists the accepted NAT modes.
+var NatModes = []NatMode{NatNone, NatSingle, NatPerZone, NatInstance}
+
+// DefaultNatInstanceType is the instance type used in NatInstance mode when
+// none is configured.
+const DefaultNatInstanceType = "t3.nano"
+
+// NatArgs configures the egress of the private subnets.
+type NatArgs struct {
+	Mode NatMode
+	// InstanceType and AmiId configure the NAT instance. The latest Amazon
+	// Linux 2023 image is used when AmiId is empty.
+	InstanceType string
+	AmiId        string
+}
+
+// natInstanceUserData turns an Amazon Linux instance into a NAT by enabling
+// forwarding and masquerading traffic leaving its default interface.
+const natInstanceUserData = `#!/bin/bash
+dnf install -y iptables-services
+systemctl enable --now iptables
+echo "net.ipv4.ip_forward = 1" > /etc/sysctl.d/90-nat.conf
+sysctl -p /etc/sysctl.d/90-nat.conf
+iface=$(ip route show default | awk '{print $5}')
+iptables -t nat -A POSTROUTING -o "$iface" -j MASQUERADE
+iptables -F FORWARD
+service iptables save
+`
+
+// natTarget is where the default route of a private route table points.
+type natTarget struct {
+	natGatewayId       pulumi.StringInput
+	networkInterfaceId pulumi.StringInput
+}
+
+// natLayerArgs holds what newNatLayer needs from the network.
+type natLayerArgs struct {
+	NatArgs
+	vpc     *ec2.Vpc
+	vpcCidr string
+	// publicSubnets holds one public subnet per zone to place NATs in.
+	publicSubnets []*ec2.Subnet
+	names         NameTags
+}
+
+// newNatLayer creates the NAT gateways or NAT instance and returns the target
+// of the default route of each zone, together with the public IPs the
+// private subnets egress from. It returns no targets in NatNone mode.
+func newNatLayer(ctx *pulumi.Context, parent pulumi.Resource, args *natLayerArgs) ([]natTarget, pulumi.StringArray, error) {
+	names := args.names
+	zones := len(args.publicSubnets)
+
+	if args.Mode != NatNone && args.Mode != "" && zones == 0 {
+		return nil, nil, fmt.Errorf("NAT mode %q needs a public subnet tier", args.Mode)
+	}
+
+	switch args.Mode {
+	case NatNone, "":
+		return nil, nil, nil
+
+	case NatSingle, NatPerZone:
+		count := 1
+		if args.Mode == NatPerZone {
+			count = zones
+		}
+		var gateways []*ec2.NatGateway
+		var publicIps pulumi.StringArray
+		for i := 0; i < count; i++ {
+			// Create an Elastic IP for the NAT gateway
+			eip, err := ec2.NewEip(ctx, names.Indexed(names.NatEipName, i+1), &ec2.EipArgs{
+				Domain: pulumi.String("vpc"),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(names.Indexed(names.NatEipName, i+1)),
+				},
+			}, childOptions(parent)...)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Create a NAT gateway in the public subnet of the zone
+			gateway, err := ec2.NewNatGateway(ctx, names.Indexed(names.NatGatewayName, i+1), &ec2.NatGatewayArgs{
+				AllocationId: eip.ID(),
+				SubnetId:     args.publicSubnets[i].ID(),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(names.Indexed(names.NatGatewayName, i+1)),
+				},
+			}, childOptions(parent)...)
+			if err != nil {
+				return nil, nil, err
+			}
+			gateways = append(gateways, gateway)
+			publicIps = append(publicIps, eip.PublicIp)
+		}
+
+		targets := make([]natTarget, zones)
+		for zone := range targets {
+			gateway := gateways[0]
+			if args.Mode == NatPerZone {
+				gateway = gateways[zone]
+			}
+			targets[zone] = natTarget{natGatewayId: gateway.ID()}
+		}
+		return targets, publicIps, nil
+
+	case NatInstance:
+		amiId := args.AmiId
+		if amiId == "" {
+			ami, err := ec2.LookupAmi(ctx, &ec2.LookupAmiArgs{
+				MostRecent: pulumi.BoolRef(true),
+				Owners:     []string{"amazon"},
+				Filters: []ec2.GetAmiFilter{
+					{Name: "name", Values: []string{"al2023-ami-2023.*-x86_64"}},
+					{Name: "state", Values: []string{"available"}},
+				},
+			}, pulumi.Parent(parent))
+			if err != nil {
+				return nil, nil, err
+			}
+			amiId = ami.Id
+		}
+		instanceType := args.InstanceType
+		if instanceType == "" {
+			instanceType = DefaultNatInstanceType
+		}
+
+		// Create a security group that lets the VPC through the NAT instance
+		securityGroup, err := ec2.NewSecurityGroup(ctx, names.NatSecurityGroupName, &ec2.SecurityGroupArgs{
+			VpcId: args.vpc.ID(),
+			Ingress: ec2.SecurityGroupIngressArray{
+				&ec2.SecurityGroupIngressArgs{
+					Description: pulumi.String("Traffic from the VPC to the internet"),
+					Protocol:    pulumi.String("-1"),
+					FromPort:    pulumi.Int(0),
+					ToPort:      pulumi.Int(0),
+					CidrBlocks:  pulumi.StringArray{pulumi.String(args.vpcCidr)},
+				},
+			},
+			Egress: ec2.SecurityGroupEgressArray{
+				&ec2.SecurityGroupEgressArgs{
+					Protocol:   pulumi.String("-1"),
+					FromPort:   pulumi.Int(0),
+					ToPort:     pulumi.Int(0),
+					CidrBlocks: pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+				},
+			},
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.NatSecurityGroupName),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Create the NAT instance in the public subnet of the first zone
+		instance, err := ec2.NewInstance(ctx, names.NatInstanceName, &ec2.InstanceArgs{
+			Ami:                 pulumi.String(amiId),
+			InstanceType:        pulumi.String(instanceType),
+			SubnetId:            args.publicSubnets[0].ID(),
+			VpcSecurityGroupIds: pulumi.StringArray{securityGroup.ID()},
+			SourceDestCheck:     pulumi.Bool(false),
+			UserData:            pulumi.String(natInstanceUserData),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.NatInstanceName),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Give the NAT instance a stable public IP
+		eip, err := ec2.NewEip(ctx, names.Indexed(names.NatEipName, 1), &ec2.EipArgs{
+			Domain:   pulumi.String("vpc"),
+			Instance: instance.ID(),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.Indexed(names.NatEipName, 1)),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		targets := make([]natTarget, zones)
+		for zone := range targets {
+			targets[zone] = natTarget{networkInterfaceId: instance.PrimaryNetworkInterfaceId}
+		}
+		return targets, pulumi.StringArray{eip.PublicIp}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown NAT mode %q", args.Mode)
+}
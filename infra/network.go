@@ -0,0 +1,353 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NetworkArgs configures the VPC and its subnets.
+type NetworkArgs struct {
+	// VpcCidr is the IPv4 block of the VPC.
+	VpcCidr string
+	// Ipv4Cidr is the destination of the public route to the internet gateway.
+	Ipv4Cidr string
+	// DualStack assigns an Amazon-provided IPv6 block to the VPC and a /64 of
+	// it to every subnet. Public subnets route Ipv6Cidr to the internet
+	// gateway, private ones to an egress-only internet gateway.
+	DualStack bool
+	Ipv6Cidr  string
+	// Tiers are the subnets created in every availability zone. Defaults to
+	// DefaultSubnetTiers.
+	Tiers []SubnetTier
+	// AvailabilityZoneCount is the number of zones the subnets are spread
+	// over. When it is zero, they are spread over as many of the available
+	// zones as there are, up to DefaultAvailabilityZoneCount.
+	AvailabilityZoneCount int
+	// ReservedCidrs are ranges of the VPC that are left free for later use.
+	ReservedCidrs []string
+	// Nat configures the egress of the private subnets. Private subnets have
+	// no route to the internet by default.
+	Nat NatArgs
+	// PrivateDns turns on the DNS support and hostnames of the VPC, which
+	// interface endpoints with private DNS names need.
+	PrivateDns bool
+	Names      NameTags
+}
+
+// Network is a VPC with one subnet per tier and availability zone.
+type Network struct {
+	pulumi.ResourceState
+
+	Vpc            *ec2.Vpc
+	Plan           *SubnetPlan
+	PublicSubnets  []*ec2.Subnet
+	PrivateSubnets []*ec2.Subnet
+	VpcId          pulumi.IDOutput
+	// SubnetIds holds the subnet ids of every tier, ordered by zone.
+	SubnetIds map[string]pulumi.StringArray
+	// PublicSubnetIds and PrivateSubnetIds hold the subnets of all public and
+	// all private tiers.
+	PublicSubnetIds  pulumi.StringArray
+	PrivateSubnetIds pulumi.StringArray
+	// RouteTableIds holds the public and every private route table.
+	RouteTableIds pulumi.StringArray
+	// NatPublicIps are the addresses the private subnets egress from. It is
+	// empty when no NAT is configured.
+	NatPublicIps pulumi.StringArray
+}
+
+// NewNetwork creates the VPC, subnets, internet gateway and route tables.
+func NewNetwork(ctx *pulumi.Context, name string, args *NetworkArgs, opts ...pulumi.ResourceOption) (*Network, error) {
+	network := &Network{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:Network", name, network, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	tiers := args.Tiers
+	if len(tiers) == 0 {
+		tiers = DefaultSubnetTiers
+	}
+
+	// Spread the subnets over the default number of zones, or as many as the
+	// region has, unless the stack sets the number
+	available, err := aws.GetAvailabilityZones(ctx, &aws.GetAvailabilityZonesArgs{
+		State: pulumi.StringRef("available"),
+	}, pulumi.Parent(network))
+	if err != nil {
+		return nil, err
+	}
+	zoneCount := args.AvailabilityZoneCount
+	if zoneCount == 0 {
+		zoneCount = min(len(available.Names), DefaultAvailabilityZoneCount)
+	}
+	if len(available.Names) < zoneCount {
+		return nil, fmt.Errorf("%d availability zones requested but only %d are available", zoneCount, len(available.Names))
+	}
+	if zoneCount < 2 {
+		return nil, fmt.Errorf("the load balancer and the database need two availability zones but only %d are available", zoneCount)
+	}
+
+	plan, err := PlanSubnets(SubnetPlanArgs{
+		VpcCidr:               args.VpcCidr,
+		Tiers:                 tiers,
+		AvailabilityZoneCount: zoneCount,
+		ReservedCidrs:         args.ReservedCidrs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a VPC
+	vpc, err := ec2.NewVpc(ctx, names.VpcName, &ec2.VpcArgs{
+		CidrBlock:                    pulumi.String(args.VpcCidr),
+		AssignGeneratedIpv6CidrBlock: pulumi.Bool(args.DualStack),
+		EnableDnsSupport:             pulumi.Bool(true),
+		EnableDnsHostnames:           pulumi.Bool(args.PrivateDns),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.VpcName),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the subnets of every tier
+	var subnetCount int
+	subnetIds := map[string]pulumi.StringArray{}
+	subnetsByTier := map[string][]*ec2.Subnet{}
+	var publicSubnets, privateSubnets []*ec2.Subnet
+	for _, tier := range tiers {
+		subnetName, err := names.SubnetName(tier.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, allocation := range plan.Tier(tier.Name) {
+			name := names.Indexed(subnetName, allocation.Zone+1)
+			subnetArgs := &ec2.SubnetArgs{
+				VpcId:               vpc.ID(),
+				CidrBlock:           pulumi.String(allocation.Cidr),
+				AvailabilityZone:    pulumi.String(available.Names[allocation.Zone]),
+				MapPublicIpOnLaunch: pulumi.Bool(tier.Public),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(name),
+					"Tier": pulumi.String(tier.Name),
+				},
+			}
+			if args.DualStack {
+				// Number the /64s in the order of the plan, so that they stay
+				// put as long as the plan does
+				ipv6Index := subnetCount
+				subnetArgs.Ipv6CidrBlock = vpc.Ipv6CidrBlock.ApplyT(func(block string) (string, error) {
+					return Ipv6SubnetCidr(block, ipv6Index)
+				}).(pulumi.StringOutput)
+				subnetArgs.AssignIpv6AddressOnCreation = pulumi.Bool(true)
+			}
+			subnetCount++
+			subnet, err := ec2.NewSubnet(ctx, name, subnetArgs, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+			subnetsByTier[tier.Name] = append(subnetsByTier[tier.Name], subnet)
+			subnetIds[tier.Name] = append(subnetIds[tier.Name], subnet.ID())
+			if tier.Public {
+				publicSubnets = append(publicSubnets, subnet)
+			} else {
+				privateSubnets = append(privateSubnets, subnet)
+			}
+		}
+	}
+
+	// Create a Internet gateway
+	internetGateway, err := ec2.NewInternetGateway(ctx, names.InternetGatewayName, &ec2.InternetGatewayArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.InternetGatewayName),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create a Public Route Table
+	publicRouteTable, err := ec2.NewRouteTable(ctx, names.PublicRouteTableName, &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.PublicRouteTableName),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a Route to the Internet
+	_, err = ec2.NewRoute(ctx, names.PublicRouteName, &ec2.RouteArgs{
+		RouteTableId:         publicRouteTable.ID(),
+		DestinationCidrBlock: pulumi.String(args.Ipv4Cidr),
+		GatewayId:            internetGateway.ID(),
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.DualStack {
+		// Create a Route to the Internet over IPv6
+		_, err = ec2.NewRoute(ctx, names.PublicIpv6RouteName, &ec2.RouteArgs{
+			RouteTableId:             publicRouteTable.ID(),
+			DestinationIpv6CidrBlock: pulumi.String(args.Ipv6Cidr),
+			GatewayId:                internetGateway.ID(),
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create the NAT gateways or NAT instance in the first public tier
+	var natSubnets []*ec2.Subnet
+	for _, tier := range tiers {
+		if tier.Public {
+			natSubnets = subnetsByTier[tier.Name]
+			break
+		}
+	}
+	natTargets, natPublicIps, err := newNatLayer(ctx, network, &natLayerArgs{
+		NatArgs:       args.Nat,
+		vpc:           vpc,
+		vpcCidr:       args.VpcCidr,
+		publicSubnets: natSubnets,
+		names:         names,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the Private Route Tables: one per zone when every zone has its
+	// own NAT gateway, otherwise one shared by all zones
+	var privateRouteTables []*ec2.RouteTable
+	if args.Nat.Mode == NatPerZone {
+		for zone := 0; zone < zoneCount; zone++ {
+			name := names.Indexed(names.PrivateZoneRouteTableName, zone+1)
+			routeTable, err := ec2.NewRouteTable(ctx, name, &ec2.RouteTableArgs{
+				VpcId: vpc.ID(),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(name),
+				},
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+			privateRouteTables = append(privateRouteTables, routeTable)
+		}
+	} else {
+		routeTable, err := ec2.NewRouteTable(ctx, names.PrivateRouteTableName, &ec2.RouteTableArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.PrivateRouteTableName),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		privateRouteTables = append(privateRouteTables, routeTable)
+	}
+
+	// Route the private subnets to the internet through the NAT
+	if len(natTargets) > 0 {
+		for i, routeTable := range privateRouteTables {
+			target := natTargets[i]
+			_, err := ec2.NewRoute(ctx, names.Indexed(names.PrivateNatRouteName, i+1), &ec2.RouteArgs{
+				RouteTableId:         routeTable.ID(),
+				DestinationCidrBlock: pulumi.String(args.Ipv4Cidr),
+				NatGatewayId:         target.natGatewayId,
+				NetworkInterfaceId:   target.networkInterfaceId,
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Let the private subnets reach the internet over IPv6, but not the
+	// other way around
+	if args.DualStack {
+		egressOnlyGateway, err := ec2.NewEgressOnlyInternetGateway(ctx, names.EgressOnlyGatewayName, &ec2.EgressOnlyInternetGatewayArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.EgressOnlyGatewayName),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		for i, routeTable := range privateRouteTables {
+			_, err := ec2.NewRoute(ctx, names.Indexed(names.PrivateIpv6RouteName, i+1), &ec2.RouteArgs{
+				RouteTableId:             routeTable.ID(),
+				DestinationIpv6CidrBlock: pulumi.String(args.Ipv6Cidr),
+				EgressOnlyGatewayId:      egressOnlyGateway.ID(),
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Associate the subnets of every tier to the route table of the tier
+	for _, tier := range tiers {
+		associationName, err := names.RouteTableAssociationName(tier.Name)
+		if err != nil {
+			return nil, err
+		}
+		for i, subnet := range subnetsByTier[tier.Name] {
+			routeTable := publicRouteTable
+			if !tier.Public {
+				routeTable = privateRouteTables[min(i, len(privateRouteTables)-1)]
+			}
+			_, err := ec2.NewRouteTableAssociation(ctx, names.Indexed(associationName, i+1), &ec2.RouteTableAssociationArgs{
+				SubnetId:     subnet.ID(),
+				RouteTableId: routeTable.ID(),
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Create a string array to store the subnet ids for the private subnet group
+	var privateSubnetIds pulumi.StringArray
+	for i := range privateSubnets {
+		privateSubnetIds = append(privateSubnetIds, privateSubnets[i].ID())
+	}
+
+	// Create a string array to store the subnet ids for the public subnet group
+	var publicSubnetIds pulumi.StringArray
+	for i := range publicSubnets {
+		publicSubnetIds = append(publicSubnetIds, publicSubnets[i].ID())
+	}
+
+	network.Vpc = vpc
+	network.Plan = plan
+	network.SubnetIds = subnetIds
+	network.PublicSubnets = publicSubnets
+	network.PrivateSubnets = privateSubnets
+	network.VpcId = vpc.ID()
+	network.PublicSubnetIds = publicSubnetIds
+	network.PrivateSubnetIds = privateSubnetIds
+	network.NatPublicIps = natPublicIps
+	network.RouteTableIds = pulumi.StringArray{publicRouteTable.ID()}
+	for _, routeTable := range privateRouteTables {
+		network.RouteTableIds = append(network.RouteTableIds, routeTable.ID())
+	}
+
+	if err := ctx.RegisterResourceOutputs(network, pulumi.Map{
+		"vpcId":            vpc.ID(),
+		"publicSubnetIds":  publicSubnetIds,
+		"privateSubnetIds": privateSubnetIds,
+		"natPublicIps":     natPublicIps,
+	}); err != nil {
+		return nil, err
+	}
+	return network, nil
+}
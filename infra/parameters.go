@@ -0,0 +1,257 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ApplyImmediate and ApplyPendingReboot are when RDS applies a parameter of
+// the parameter group.
+const (
+	ApplyImmediate = "immediate"
+	// ApplyPendingReboot waits for the next reboot, which static parameters
+	// need.
+	ApplyPendingReboot = "pending-reboot"
+)
+
+// ApplyMethods lists the accepted apply methods.
+var ApplyMethods = []string{ApplyImmediate, ApplyPendingReboot}
+
+// DatabaseParameter is a parameter of the parameter group of the database,
+// keyed by its name.
+type DatabaseParameter struct {
+	Value string `json:"value"`
+	// ApplyMethod defaults to ApplyImmediate.
+	ApplyMethod string `json:"applyMethod"`
+}
+
+// applyMethod returns the apply method of the parameter, defaulting to
+// immediate.
+func (p DatabaseParameter) applyMethod() string {
+	if p.ApplyMethod == "" {
+		return ApplyImmediate
+	}
+	return p.ApplyMethod
+}
+
+// DatabaseOption is an option of the option group of the database, such as
+// the MARIADB_AUDIT_PLUGIN of MariaDB.
+type DatabaseOption struct {
+	Name     string            `json:"name"`
+	Settings map[string]string `json:"settings"`
+}
+
+// databaseEngine describes the parameter groups and option groups of an
+// engine.
+type databaseEngine struct {
+	// majorVersionParts is how many parts of the engine version name its
+	// parameter group family.
+	majorVersionParts int
+	// parameterName matches the syntax of the parameter names of the
+	// engine. Whether the engine knows a parameter is only checked by RDS.
+	parameterName *regexp.Regexp
+	// options tells whether the engine has option groups.
+	options bool
+}
+
+// databaseEngines are the engines the database can run.
+var databaseEngines = map[string]databaseEngine{
+	"mariadb": {
+		majorVersionParts: 2,
+		parameterName:     regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`),
+		options:           true,
+	},
+	"mysql": {
+		majorVersionParts: 2,
+		parameterName:     regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`),
+		options:           true,
+	},
+	// PostgreSQL parameters include mixed case ones such as DateStyle
+	"postgres": {
+		majorVersionParts: 1,
+		parameterName:     regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.]*$`),
+	},
+	// Aurora versions start with the version of the engine they are
+	// compatible with, e.g. 8.0.mysql_aurora.3.04.0
+	"aurora-mysql": {
+		majorVersionParts: 2,
+		parameterName:     regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`),
+	},
+	"aurora-postgresql": {
+		majorVersionParts: 1,
+		parameterName:     regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.]*$`),
+	},
+}
+
+// optionName matches the names of options and of their settings.
+var optionName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// DatabaseEngines returns the engines the database can run, sorted.
+func DatabaseEngines() []string {
+	engines := make([]string, 0, len(databaseEngines))
+	for engine := range databaseEngines {
+		engines = append(engines, engine)
+	}
+	sort.Strings(engines)
+	return engines
+}
+
+// MajorEngineVersion returns the major version of an engine version, e.g.
+// 10.11 for MariaDB 10.11.5 and 15 for PostgreSQL 15.4. PostgreSQL 9.6 and
+// older count two parts.
+func MajorEngineVersion(engine string, version string) string {
+	parts := strings.Split(version, ".")
+	n := databaseEngines[engine].majorVersionParts
+	if n == 1 && parts[0] == "9" {
+		n = 2
+	}
+	if n == 0 || len(parts) < n {
+		return version
+	}
+	return strings.Join(parts[:n], ".")
+}
+
+// ParameterGroupFamily returns the parameter group family of an engine
+// version, e.g. mariadb10.11 for MariaDB 10.11.5.
+func ParameterGroupFamily(engine string, version string) string {
+	return engine + MajorEngineVersion(engine, version)
+}
+
+// ValidateParameters reports every parameter whose name does not follow the
+// naming of the engine, that has no value or that has an unknown apply
+// method. It does not know the parameters of each family, which the provider
+// cannot list: RDS rejects unknown parameters when the parameter group is
+// created.
+func ValidateParameters(engine string, parameters map[string]DatabaseParameter) error {
+	var errs []error
+	for _, name := range sortedParameterNames(parameters) {
+		parameter := parameters[name]
+		if e, ok := databaseEngines[engine]; ok && !e.parameterName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%q is not a valid %s parameter name", name, engine))
+		}
+		if parameter.Value == "" {
+			errs = append(errs, fmt.Errorf("parameter %s has no value", name))
+		}
+		if parameter.ApplyMethod != "" && !slices.Contains(ApplyMethods, parameter.ApplyMethod) {
+			errs = append(errs, fmt.Errorf("parameter %s has apply method %q, want one of %s", name, parameter.ApplyMethod, strings.Join(ApplyMethods, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkParameterGroupFamily looks up the engine version in RDS and checks
+// that Family is its parameter group family, so that a version RDS does not
+// offer or a family that does not match it fails the preview.
+func checkParameterGroupFamily(ctx *pulumi.Context, database *Database, args *DatabaseArgs) error {
+	version, err := rds.GetEngineVersion(ctx, &rds.GetEngineVersionArgs{
+		Engine:  args.Engine,
+		Version: pulumi.StringRef(args.EngineVersion),
+	}, pulumi.Parent(database))
+	if err != nil {
+		return fmt.Errorf("looking up %s %s: %w", args.Engine, args.EngineVersion, err)
+	}
+	if version.ParameterGroupFamily != args.Family {
+		return fmt.Errorf("the parameter group family of %s %s is %s, not %s", args.Engine, args.EngineVersion, version.ParameterGroupFamily, args.Family)
+	}
+	return nil
+}
+
+// ValidateOptions reports options given to an engine without option groups,
+// option and setting names that are not well-formed, and options given more
+// than once.
+func ValidateOptions(engine string, options []DatabaseOption) error {
+	if len(options) == 0 {
+		return nil
+	}
+	if e, ok := databaseEngines[engine]; ok && !e.options {
+		return fmt.Errorf("%s has no option groups", engine)
+	}
+	var errs []error
+	seen := map[string]bool{}
+	for _, option := range options {
+		if !optionName.MatchString(option.Name) {
+			errs = append(errs, fmt.Errorf("%q is not an option name", option.Name))
+		}
+		if seen[option.Name] {
+			errs = append(errs, fmt.Errorf("option %s is given more than once", option.Name))
+		}
+		seen[option.Name] = true
+		for setting := range option.Settings {
+			if !optionName.MatchString(setting) {
+				errs = append(errs, fmt.Errorf("option %s has setting %q, which is not a setting name", option.Name, setting))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedParameterNames returns the names of the parameters in the order
+// they are rendered, so that the parameter group does not change between
+// runs.
+func sortedParameterNames(parameters map[string]DatabaseParameter) []string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parameterGroupParameters renders the parameters of the parameter group.
+func parameterGroupParameters(parameters map[string]DatabaseParameter) rds.ParameterGroupParameterArray {
+	var rendered rds.ParameterGroupParameterArray
+	for _, name := range sortedParameterNames(parameters) {
+		parameter := parameters[name]
+		rendered = append(rendered, rds.ParameterGroupParameterArgs{
+			Name:        pulumi.String(name),
+			Value:       pulumi.String(parameter.Value),
+			ApplyMethod: pulumi.String(parameter.applyMethod()),
+		})
+	}
+	return rendered
+}
+
+// optionGroupOptions renders the options of the option group.
+func optionGroupOptions(options []DatabaseOption) rds.OptionGroupOptionArray {
+	var rendered rds.OptionGroupOptionArray
+	for _, option := range options {
+		settingNames := make([]string, 0, len(option.Settings))
+		for name := range option.Settings {
+			settingNames = append(settingNames, name)
+		}
+		sort.Strings(settingNames)
+		var settings rds.OptionGroupOptionOptionSettingArray
+		for _, name := range settingNames {
+			settings = append(settings, rds.OptionGroupOptionOptionSettingArgs{
+				Name:  pulumi.String(name),
+				Value: pulumi.String(option.Settings[name]),
+			})
+		}
+		rendered = append(rendered, rds.OptionGroupOptionArgs{
+			OptionName:     pulumi.String(option.Name),
+			OptionSettings: settings,
+		})
+	}
+	return rendered
+}
+
+// clusterParameterGroupParameters renders the parameters of the cluster
+// parameter group of an Aurora cluster.
+func clusterParameterGroupParameters(parameters map[string]DatabaseParameter) rds.ClusterParameterGroupParameterArray {
+	var rendered rds.ClusterParameterGroupParameterArray
+	for _, name := range sortedParameterNames(parameters) {
+		parameter := parameters[name]
+		rendered = append(rendered, rds.ClusterParameterGroupParameterArgs{
+			Name:        pulumi.String(name),
+			Value:       pulumi.String(parameter.Value),
+			ApplyMethod: pulumi.String(parameter.applyMethod()),
+		})
+	}
+	return rendered
+}
@@ -0,0 +1,75 @@
+package infra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParameterGroupFamily(t *testing.T) {
+	for _, test := range []struct {
+		engine, version, want string
+	}{
+		{"mariadb", "10.11.5", "mariadb10.11"},
+		{"mysql", "8.0.35", "mysql8.0"},
+		{"postgres", "15.4", "postgres15"},
+		{"postgres", "9.6.22", "postgres9.6"},
+		{"aurora-mysql", "8.0.mysql_aurora.3.04.0", "aurora-mysql8.0"},
+		{"aurora-postgresql", "15.4", "aurora-postgresql15"},
+	} {
+		if got := ParameterGroupFamily(test.engine, test.version); got != test.want {
+			t.Errorf("ParameterGroupFamily(%s, %s) = %s, want %s", test.engine, test.version, got, test.want)
+		}
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	if err := ValidateParameters("postgres", map[string]DatabaseParameter{
+		"rds.force_ssl":            {Value: "1"},
+		"DateStyle":                {Value: "ISO, MDY", ApplyMethod: ApplyImmediate},
+		"shared_preload_libraries": {Value: "pg_stat_statements", ApplyMethod: ApplyPendingReboot},
+	}); err != nil {
+		t.Errorf("valid parameters are rejected: %v", err)
+	}
+
+	err := ValidateParameters("mariadb", map[string]DatabaseParameter{
+		"DateStyle":       {Value: "ISO"},
+		"max_connections": {},
+		"slow_query_log":  {Value: "1", ApplyMethod: "later"},
+	})
+	if err == nil {
+		t.Fatalf("expected invalid parameters to fail")
+	}
+	for _, want := range []string{
+		`"DateStyle" is not a valid mariadb parameter name`,
+		"parameter max_connections has no value",
+		`parameter slow_query_log has apply method "later"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	audit := DatabaseOption{Name: "MARIADB_AUDIT_PLUGIN", Settings: map[string]string{"SERVER_AUDIT_EVENTS": "CONNECT,QUERY"}}
+	if err := ValidateOptions("mariadb", []DatabaseOption{audit}); err != nil {
+		t.Errorf("the audit plugin is rejected: %v", err)
+	}
+	if err := ValidateOptions("postgres", []DatabaseOption{audit}); err == nil || !strings.Contains(err.Error(), "postgres has no option groups") {
+		t.Errorf("got %v, want postgres to have no option groups", err)
+	}
+
+	err := ValidateOptions("mariadb", []DatabaseOption{audit, audit, {Name: "audit", Settings: map[string]string{"events": "QUERY"}}})
+	if err == nil {
+		t.Fatalf("expected invalid options to fail")
+	}
+	for _, want := range []string{
+		"option MARIADB_AUDIT_PLUGIN is given more than once",
+		`"audit" is not an option name`,
+		`option audit has setting "events"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/dynamodb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sns"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// SubmissionPipelineArgs configures the SNS topic and the Lambda function that
+// processes assignment submissions.
+type SubmissionPipelineArgs struct {
+	// CodePath is the zip archive with the Lambda deployment package.
+	CodePath   string
+	Region     string
+	DomainName string
+	// BucketName and GoogleCredentials give the Lambda access to the GCS
+	// bucket. GoogleCredentials and MailgunSmtpKey are stored in Secrets
+	// Manager, and the Lambda only gets the ARNs of their secrets.
+	BucketName        pulumi.StringInput
+	GoogleCredentials pulumi.StringInput
+	MailgunUserName   string
+	MailgunSmtpKey    pulumi.StringInput
+	Names             NameTags
+}
+
+// SubmissionPipeline is an SNS topic subscribed to by a Lambda function that
+// records submissions in DynamoDB and uploads them to GCS.
+type SubmissionPipeline struct {
+	pulumi.ResourceState
+
+	Topic       *sns.Topic
+	Table       *dynamodb.Table
+	Function    *lambda.Function
+	TopicArn    pulumi.StringOutput
+	TableName   pulumi.StringOutput
+	FunctionArn pulumi.StringOutput
+}
+
+// NewSubmissionPipeline creates the topic, table, Lambda function, the
+// secrets of the function and the subscription between them.
+func NewSubmissionPipeline(ctx *pulumi.Context, name string, args *SubmissionPipelineArgs, opts ...pulumi.ResourceOption) (*SubmissionPipeline, error) {
+	pipeline := &SubmissionPipeline{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:SubmissionPipeline", name, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	// Create a SNS Topic
+	topic, err := sns.NewTopic(ctx, names.TopicName, &sns.TopicArgs{}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a DynamoDB Table
+	table, err := dynamodb.NewTable(ctx, names.DynamoDBName, &dynamodb.TableArgs{
+		Attributes: dynamodb.TableAttributeArray{
+			&dynamodb.TableAttributeArgs{
+				Name: pulumi.String("Id"),
+				Type: pulumi.String("S"),
+			},
+		},
+		HashKey:       pulumi.String("Id"),
+		ReadCapacity:  pulumi.Int(5),
+		WriteCapacity: pulumi.Int(5),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create a Role for Lambda
+	lambdaRole, err := iam.NewRole(ctx, names.LambdaRoleName, &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+				"Version": "2012-10-17",
+				"Statement": [
+					{
+					"Action": "sts:AssumeRole",
+					"Principal": {
+						"Service": "lambda.amazonaws.com"
+					},
+					"Effect": "Allow",
+					"Sid": ""
+					}
+				]
+				}`),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the Lambda use the submission table only
+	_, err = iam.NewRolePolicy(ctx, names.DynamoDBPolicyName, &iam.RolePolicyArgs{
+		Role: lambdaRole.Name,
+		Policy: policyDocument(policyStatement{
+			Sid: "UseSubmissionTable",
+			Actions: []string{
+				"dynamodb:GetItem",
+				"dynamodb:PutItem",
+				"dynamodb:UpdateItem",
+				"dynamodb:DeleteItem",
+				"dynamodb:Scan",
+				"dynamodb:Query",
+			},
+			Resources: []pulumi.StringInput{table.Arn},
+		}),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the credentials of the Lambda in Secrets Manager
+	smtpKeySecret, err := newSecret(ctx, pipeline, &secretArgs{
+		Name:        names.SmtpKeySecretName,
+		VersionName: names.SmtpKeySecretVersionName,
+		Description: "Mailgun SMTP key of the submission Lambda",
+		Value:       args.MailgunSmtpKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gcpKeySecret, err := newSecret(ctx, pipeline, &secretArgs{
+		Name:        names.GcpKeySecretName,
+		VersionName: names.GcpKeySecretVersionName,
+		Description: "GCP service account key of the submission Lambda",
+		Value:       args.GoogleCredentials,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicy(ctx, names.LambdaSecretsPolicyName, &iam.RolePolicyArgs{
+		Role: lambdaRole.Name,
+		Policy: policyDocument(policyStatement{
+			Sid:       "ReadCredentials",
+			Actions:   []string{"secretsmanager:GetSecretValue"},
+			Resources: []pulumi.StringInput{smtpKeySecret.Arn, gcpKeySecret.Arn},
+		}),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new Lambda Function
+	function, err := lambda.NewFunction(ctx, names.LambdaFunctionName, &lambda.FunctionArgs{
+		Code:    pulumi.NewFileArchive(args.CodePath),
+		Handler: pulumi.String("lambda.lambda_handler"),
+		Runtime: pulumi.String("python3.11"),
+		Role:    lambdaRole.Arn,
+		Timeout: pulumi.Int(15),
+		Environment: &lambda.FunctionEnvironmentArgs{
+			Variables: pulumi.StringMap{
+				"GOOGLE_CREDENTIALS_SECRET_ARN": gcpKeySecret.Arn,
+				"FROM_ADDRESS":                  pulumi.String("mailgun@" + args.DomainName),
+				"GCP_BUCKET_NAME":               args.BucketName,
+				"DYNAMO_TABLE_NAME":             table.Name,
+				"MAILGUN_USERNAME":              pulumi.String(args.MailgunUserName),
+				"MAILGUN_SMTP_KEY_SECRET_ARN":   smtpKeySecret.Arn,
+			},
+		},
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the account of the log group ARN
+	identity, err := aws.GetCallerIdentity(ctx, nil, pulumi.Parent(pipeline))
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the Lambda write to its own log group
+	_, err = iam.NewRolePolicy(ctx, names.LambdaLogsPolicyName, &iam.RolePolicyArgs{
+		Role: lambdaRole.Name,
+		Policy: policyDocument(policyStatement{
+			Sid: "WriteFunctionLogs",
+			Actions: []string{
+				"logs:CreateLogGroup",
+				"logs:CreateLogStream",
+				"logs:PutLogEvents",
+			},
+			Resources: []pulumi.StringInput{
+				logGroupArn(args.Region, identity.AccountId, pulumi.Sprintf("/aws/lambda/%s", function.Name)),
+			},
+		}),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a Trigger to lambda from SNS
+	_, err = lambda.NewPermission(ctx, names.LambdaFunctionPermissionName, &lambda.PermissionArgs{
+		Action:    pulumi.String("lambda:InvokeFunction"),
+		Function:  function.Name,
+		Principal: pulumi.String("sns.amazonaws.com"),
+		SourceArn: topic.Arn,
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// SNS Topic Subscription
+	_, err = sns.NewTopicSubscription(ctx, names.LambdaSubscriptionName, &sns.TopicSubscriptionArgs{
+		Topic:    topic.Arn,
+		Protocol: pulumi.String("lambda"),
+		Endpoint: function.Arn,
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline.Topic = topic
+	pipeline.Table = table
+	pipeline.Function = function
+	pipeline.TopicArn = topic.Arn
+	pipeline.TableName = table.Name
+	pipeline.FunctionArn = function.Arn
+
+	if err := ctx.RegisterResourceOutputs(pipeline, pulumi.Map{
+		"topicArn":    topic.Arn,
+		"tableName":   table.Name,
+		"functionArn": function.Arn,
+	}); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,46 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// secretArgs holds what newSecret needs to store a value in Secrets Manager.
+type secretArgs struct {
+	// Name is the name of the secret, VersionName the name of its value.
+	Name        string
+	VersionName string
+	Description string
+	Value       pulumi.StringInput
+}
+
+// storedSecret is a Secrets Manager secret and the version of its value,
+// which is replaced whenever the value changes.
+type storedSecret struct {
+	*secretsmanager.Secret
+	Version *secretsmanager.SecretVersion
+}
+
+// newSecret stores the value in a Secrets Manager secret and returns the
+// secret. The secret is auto-named, so that it can be replaced while a
+// deleted one is still in its recovery window.
+func newSecret(ctx *pulumi.Context, parent pulumi.Resource, args *secretArgs) (*storedSecret, error) {
+	secret, err := secretsmanager.NewSecret(ctx, args.Name, &secretsmanager.SecretArgs{
+		Description: pulumi.String(args.Description),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(args.Name),
+		},
+	}, childOptions(parent)...)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := secretsmanager.NewSecretVersion(ctx, args.VersionName, &secretsmanager.SecretVersionArgs{
+		SecretId:     secret.ID(),
+		SecretString: pulumi.ToSecret(args.Value).(pulumi.StringOutput),
+	}, childOptions(parent)...)
+	if err != nil {
+		return nil, err
+	}
+	return &storedSecret{Secret: secret, Version: version}, nil
+}
@@ -0,0 +1,219 @@
+package infra
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strconv"
+)
+
+// SecurityGroupsArgs configures the load balancer, application and database
+// security groups.
+type SecurityGroupsArgs struct {
+	VpcId pulumi.StringInput
+	// Ipv4Cidr and Ipv6Cidr are the sources allowed to reach the load balancer.
+	Ipv4Cidr string
+	Ipv6Cidr string
+	// Ports are opened on the application security group to the load balancer.
+	Ports []int
+	// Listeners are the ports opened on the load balancer security group.
+	// Defaults to DefaultListeners.
+	Listeners    []Listener
+	AppPort      int
+	DatabasePort int
+	// VpcEndpoints creates a security group for the interface endpoints and
+	// narrows the HTTPS egress of the application to it, instead of opening
+	// it to the internet.
+	VpcEndpoints bool
+	Names        NameTags
+}
+
+// SecurityGroups holds the security groups shared by the web and database tiers.
+type SecurityGroups struct {
+	pulumi.ResourceState
+
+	LoadBalancer *ec2.SecurityGroup
+	Application  *ec2.SecurityGroup
+	Database     *ec2.SecurityGroup
+	// VpcEndpoint is only created when VpcEndpoints is set.
+	VpcEndpoint *ec2.SecurityGroup
+}
+
+// NewSecurityGroups creates the security groups and the rules between them.
+func NewSecurityGroups(ctx *pulumi.Context, name string, args *SecurityGroupsArgs, opts ...pulumi.ResourceOption) (*SecurityGroups, error) {
+	groups := &SecurityGroups{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:SecurityGroups", name, groups, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+
+	listeners := args.Listeners
+	if len(listeners) == 0 {
+		listeners = DefaultListeners
+	}
+
+	// Create an ingress rule for every listener of the load balancer
+	var loadBalancerSecurityGroupIngressRules ec2.SecurityGroupIngressArray
+
+	for _, listener := range listeners {
+		loadBalancerSecurityGroupIngressRules = append(loadBalancerSecurityGroupIngressRules, &ec2.SecurityGroupIngressArgs{
+			Description:    pulumi.String(listener.Protocol + " from the internet for port " + strconv.Itoa(listener.Port)),
+			FromPort:       pulumi.Int(listener.Port),
+			ToPort:         pulumi.Int(listener.Port),
+			Protocol:       pulumi.String("tcp"),
+			CidrBlocks:     pulumi.StringArray{pulumi.String(args.Ipv4Cidr)},
+			Ipv6CidrBlocks: pulumi.StringArray{pulumi.String(args.Ipv6Cidr)},
+		})
+	}
+
+	// Create load balancer security group
+	loadBalancerSecurityGroup, err := ec2.NewSecurityGroup(ctx, names.LoadBalancerSecurityGroupName, &ec2.SecurityGroupArgs{
+		VpcId:   args.VpcId,
+		Ingress: loadBalancerSecurityGroupIngressRules,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.LoadBalancerSecurityGroupName),
+		},
+	}, childOptions(groups)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create ingress rules for the application security group
+	var securityGroupIngressRules ec2.SecurityGroupIngressArray
+
+	for i := range args.Ports {
+		securityGroupIngressRules = append(securityGroupIngressRules, &ec2.SecurityGroupIngressArgs{
+			Description: pulumi.String("TLS from VPC for port " + strconv.Itoa(args.Ports[i])),
+			FromPort:    pulumi.Int(args.Ports[i]),
+			ToPort:      pulumi.Int(args.Ports[i]),
+			Protocol:    pulumi.String("tcp"),
+			SecurityGroups: pulumi.StringArray{
+				loadBalancerSecurityGroup.ID(),
+			},
+		})
+	}
+	// Create application security group
+	securityGroup, err := ec2.NewSecurityGroup(ctx, names.SecurityGroupName, &ec2.SecurityGroupArgs{
+		VpcId:   args.VpcId,
+		Ingress: securityGroupIngressRules,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.SecurityGroupName),
+		},
+	}, childOptions(groups)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create database security group
+	databaseSecurityGroup, err := ec2.NewSecurityGroup(ctx, names.DatabaseSecurityGroupName, &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+		Ingress: ec2.SecurityGroupIngressArray{
+			&ec2.SecurityGroupIngressArgs{
+				SecurityGroups: pulumi.StringArray{
+					securityGroup.ID(),
+				},
+				Protocol: pulumi.String("tcp"),
+				FromPort: pulumi.Int(args.DatabasePort),
+				ToPort:   pulumi.Int(args.DatabasePort),
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.DatabaseSecurityGroupName),
+		},
+	}, childOptions(groups)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create egress rule for application security group to access database
+	_, err = ec2.NewSecurityGroupRule(ctx, names.ApplicationDatabaseEgressName, &ec2.SecurityGroupRuleArgs{
+		Type:                  pulumi.String("egress"),
+		FromPort:              pulumi.Int(args.DatabasePort),
+		ToPort:                pulumi.Int(args.DatabasePort),
+		Protocol:              pulumi.String("tcp"),
+		SecurityGroupId:       securityGroup.ID(),
+		SourceSecurityGroupId: databaseSecurityGroup.ID(),
+	}, childOptions(groups)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpointSecurityGroup *ec2.SecurityGroup
+	if args.VpcEndpoints {
+		// Create the security group of the interface endpoints
+		endpointSecurityGroup, err = ec2.NewSecurityGroup(ctx, names.VpcEndpointSecurityGroupName, &ec2.SecurityGroupArgs{
+			VpcId: args.VpcId,
+			Ingress: ec2.SecurityGroupIngressArray{
+				&ec2.SecurityGroupIngressArgs{
+					Description: pulumi.String("HTTPS from the application"),
+					SecurityGroups: pulumi.StringArray{
+						securityGroup.ID(),
+					},
+					Protocol: pulumi.String("tcp"),
+					FromPort: pulumi.Int(443),
+					ToPort:   pulumi.Int(443),
+				},
+			},
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(names.VpcEndpointSecurityGroupName),
+			},
+		}, childOptions(groups)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Create egress rule for application security group to access the endpoints
+		_, err = ec2.NewSecurityGroupRule(ctx, names.ApplicationEndpointEgressName, &ec2.SecurityGroupRuleArgs{
+			Type:                  pulumi.String("egress"),
+			FromPort:              pulumi.Int(443),
+			ToPort:                pulumi.Int(443),
+			Protocol:              pulumi.String("tcp"),
+			SecurityGroupId:       securityGroup.ID(),
+			SourceSecurityGroupId: endpointSecurityGroup.ID(),
+		}, childOptions(groups)...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Create egress rule for application security group to access cloudwatch
+		_, err = ec2.NewSecurityGroupRule(ctx, names.ApplicationCloudwatchEgressName, &ec2.SecurityGroupRuleArgs{
+			Type:            pulumi.String("egress"),
+			FromPort:        pulumi.Int(443),
+			ToPort:          pulumi.Int(443),
+			Protocol:        pulumi.String("tcp"),
+			SecurityGroupId: securityGroup.ID(),
+			CidrBlocks:      pulumi.StringArray{pulumi.String(args.Ipv4Cidr)},
+			Ipv6CidrBlocks:  pulumi.StringArray{pulumi.String(args.Ipv6Cidr)},
+		}, childOptions(groups)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create egress rule for load balancer security group to access application
+	_, err = ec2.NewSecurityGroupRule(ctx, names.LoadBalancerEgressName, &ec2.SecurityGroupRuleArgs{
+		Type:                  pulumi.String("egress"),
+		FromPort:              pulumi.Int(args.AppPort),
+		ToPort:                pulumi.Int(args.AppPort),
+		Protocol:              pulumi.String("tcp"),
+		SecurityGroupId:       loadBalancerSecurityGroup.ID(),
+		SourceSecurityGroupId: securityGroup.ID(),
+	}, childOptions(groups)...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups.LoadBalancer = loadBalancerSecurityGroup
+	groups.Application = securityGroup
+	groups.Database = databaseSecurityGroup
+	groups.VpcEndpoint = endpointSecurityGroup
+
+	if err := ctx.RegisterResourceOutputs(groups, pulumi.Map{
+		"loadBalancerSecurityGroupId": loadBalancerSecurityGroup.ID(),
+		"applicationSecurityGroupId":  securityGroup.ID(),
+		"databaseSecurityGroupId":     databaseSecurityGroup.ID(),
+	}); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
@@ -0,0 +1,212 @@
+package infra
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// SubnetTier describes one tier of subnets, created once per availability
+// zone, e.g. public, private-app or private-db.
+type SubnetTier struct {
+	Name string `json:"name"`
+	// PrefixLength is the size of each subnet of the tier, e.g. 24 for a /24.
+	PrefixLength int `json:"prefixLength"`
+	// Public tiers are routed to the internet gateway and map public IPs on
+	// launch.
+	Public bool `json:"public"`
+	// Cidrs pins the subnets of the tier, one per availability zone, instead
+	// of allocating them. Use it to keep subnets that already exist.
+	Cidrs []string `json:"cidrs,omitempty"`
+}
+
+// DefaultAvailabilityZoneCount is the most zones the subnets are spread over
+// when the stack does not set the number.
+const DefaultAvailabilityZoneCount = 3
+
+// DefaultSubnetTiers are the tiers used when the stack does not configure
+// any: a public and a private /24 per availability zone.
+var DefaultSubnetTiers = []SubnetTier{
+	{Name: "public", PrefixLength: 24, Public: true},
+	{Name: "private", PrefixLength: 24},
+}
+
+// SubnetPlanArgs configures PlanSubnets.
+type SubnetPlanArgs struct {
+	VpcCidr               string
+	Tiers                 []SubnetTier
+	AvailabilityZoneCount int
+	// ReservedCidrs are ranges of the VPC that no subnet may use.
+	ReservedCidrs []string
+}
+
+// SubnetAllocation is the CIDR block given to one subnet of a tier.
+type SubnetAllocation struct {
+	Tier string
+	// Zone is the index of the availability zone, starting at 0.
+	Zone int
+	Cidr string
+}
+
+// SubnetPlan is the deterministic layout of every subnet in the VPC.
+type SubnetPlan struct {
+	Allocations []SubnetAllocation
+}
+
+// Tier returns the allocations of one tier, ordered by availability zone.
+func (p *SubnetPlan) Tier(name string) []SubnetAllocation {
+	var allocations []SubnetAllocation
+	for _, allocation := range p.Allocations {
+		if allocation.Tier == name {
+			allocations = append(allocations, allocation)
+		}
+	}
+	return allocations
+}
+
+// PlanSubnets lays out the subnets of every tier in every availability zone.
+// Pinned CIDRs are placed first; every other subnet gets the lowest free,
+// aligned block of its size, tier by tier and zone by zone, so the same
+// arguments always produce the same plan. It fails if a tier is invalid,
+// pinned or reserved ranges overlap, or the VPC runs out of space.
+func PlanSubnets(args SubnetPlanArgs) (*SubnetPlan, error) {
+	vpc, err := netip.ParsePrefix(args.VpcCidr)
+	if err != nil || !vpc.Addr().Is4() {
+		return nil, fmt.Errorf("VPC CIDR %q is not an IPv4 CIDR block", args.VpcCidr)
+	}
+	if vpc != vpc.Masked() {
+		return nil, fmt.Errorf("VPC CIDR %q has host bits set, did you mean %s?", args.VpcCidr, vpc.Masked())
+	}
+	if args.AvailabilityZoneCount < 1 {
+		return nil, fmt.Errorf("at least one availability zone is required, got %d", args.AvailabilityZoneCount)
+	}
+	if len(args.Tiers) == 0 {
+		return nil, fmt.Errorf("at least one subnet tier is required")
+	}
+
+	// used holds every range that is taken, with a description for errors.
+	type usedRange struct {
+		prefix netip.Prefix
+		owner  string
+	}
+	var used []usedRange
+	claim := func(prefix netip.Prefix, owner string) error {
+		if !vpc.Contains(prefix.Addr()) || prefix.Bits() < vpc.Bits() {
+			return fmt.Errorf("%s %s is outside the VPC %s", owner, prefix, vpc)
+		}
+		for _, u := range used {
+			if u.prefix.Overlaps(prefix) {
+				return fmt.Errorf("%s %s overlaps %s %s", owner, prefix, u.owner, u.prefix)
+			}
+		}
+		used = append(used, usedRange{prefix, owner})
+		return nil
+	}
+
+	for _, cidr := range args.ReservedCidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil || !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("reserved range %q is not an IPv4 CIDR block", cidr)
+		}
+		if err := claim(prefix.Masked(), "reserved range"); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, tier := range args.Tiers {
+		if tier.Name == "" {
+			return nil, fmt.Errorf("every subnet tier needs a name")
+		}
+		if seen[tier.Name] {
+			return nil, fmt.Errorf("subnet tier %q is defined twice", tier.Name)
+		}
+		seen[tier.Name] = true
+		if tier.PrefixLength < vpc.Bits() || tier.PrefixLength > 28 {
+			return nil, fmt.Errorf("subnet tier %q has prefix length /%d, want between /%d and /28", tier.Name, tier.PrefixLength, vpc.Bits())
+		}
+		if len(tier.Cidrs) > 0 && len(tier.Cidrs) != args.AvailabilityZoneCount {
+			return nil, fmt.Errorf("subnet tier %q pins %d CIDRs for %d availability zones", tier.Name, len(tier.Cidrs), args.AvailabilityZoneCount)
+		}
+	}
+
+	plan := &SubnetPlan{}
+	// Place the pinned subnets first so that allocated ones go around them.
+	pinned := map[string][]netip.Prefix{}
+	for _, tier := range args.Tiers {
+		for zone, cidr := range tier.Cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil || !prefix.Addr().Is4() || prefix != prefix.Masked() {
+				return nil, fmt.Errorf("subnet tier %q pins %q, which is not an IPv4 CIDR block", tier.Name, cidr)
+			}
+			if prefix.Bits() != tier.PrefixLength {
+				return nil, fmt.Errorf("subnet tier %q pins %s, want a /%d", tier.Name, prefix, tier.PrefixLength)
+			}
+			if err := claim(prefix, fmt.Sprintf("subnet %s-%d", tier.Name, zone+1)); err != nil {
+				return nil, err
+			}
+			pinned[tier.Name] = append(pinned[tier.Name], prefix)
+		}
+	}
+
+	for _, tier := range args.Tiers {
+		for zone := 0; zone < args.AvailabilityZoneCount; zone++ {
+			if prefixes, ok := pinned[tier.Name]; ok {
+				plan.Allocations = append(plan.Allocations, SubnetAllocation{tier.Name, zone, prefixes[zone].String()})
+				continue
+			}
+			owner := fmt.Sprintf("subnet %s-%d", tier.Name, zone+1)
+			var allocated bool
+			for candidate := netip.PrefixFrom(vpc.Addr(), tier.PrefixLength); vpc.Contains(candidate.Addr()); {
+				if claim(candidate, owner) == nil {
+					plan.Allocations = append(plan.Allocations, SubnetAllocation{tier.Name, zone, candidate.String()})
+					allocated = true
+					break
+				}
+				next, ok := nextPrefix(candidate)
+				if !ok {
+					break
+				}
+				candidate = next
+			}
+			if !allocated {
+				return nil, fmt.Errorf("VPC %s has no free /%d left for %s", vpc, tier.PrefixLength, owner)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// nextPrefix returns the block of the same size that follows prefix.
+func nextPrefix(prefix netip.Prefix) (netip.Prefix, bool) {
+	addr := prefix.Addr().As4()
+	n := uint64(addr[0])<<24 | uint64(addr[1])<<16 | uint64(addr[2])<<8 | uint64(addr[3])
+	n += 1 << (32 - prefix.Bits())
+	if n > 0xFFFFFFFF {
+		return netip.Prefix{}, false
+	}
+	next := netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	return netip.PrefixFrom(next, prefix.Bits()), true
+}
+
+// Ipv6SubnetCidr returns the index-th /64 of the IPv6 block of a VPC. AWS
+// gives each VPC a /56, so there is room for 256 subnets.
+func Ipv6SubnetCidr(vpcCidr string, index int) (string, error) {
+	vpc, err := netip.ParsePrefix(vpcCidr)
+	if err != nil || !vpc.Addr().Is6() {
+		return "", fmt.Errorf("VPC IPv6 CIDR %q is not an IPv6 CIDR block", vpcCidr)
+	}
+	if vpc.Bits() > 64 {
+		return "", fmt.Errorf("VPC IPv6 CIDR %s is smaller than a /64", vpc)
+	}
+	if index < 0 || index >= 1<<(64-vpc.Bits()) {
+		return "", fmt.Errorf("VPC IPv6 CIDR %s has no /64 number %d", vpc, index)
+	}
+	addr := vpc.Masked().Addr().As16()
+	network := uint64(addr[0])<<56 | uint64(addr[1])<<48 | uint64(addr[2])<<40 | uint64(addr[3])<<32 |
+		uint64(addr[4])<<24 | uint64(addr[5])<<16 | uint64(addr[6])<<8 | uint64(addr[7])
+	network += uint64(index)
+	for i := 0; i < 8; i++ {
+		addr[i] = byte(network >> (56 - 8*i))
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(addr), 64).String(), nil
+}
@@ -0,0 +1,180 @@
+package infra
+
+import (
+	"strings"
+	"testing"
+)
+
+// cidrs returns the CIDR blocks of allocations in order.
+func cidrs(allocations []SubnetAllocation) []string {
+	blocks := make([]string, len(allocations))
+	for i, allocation := range allocations {
+		blocks[i] = allocation.Cidr
+	}
+	return blocks
+}
+
+func TestPlanSubnetsDefaultTiers(t *testing.T) {
+	plan, err := PlanSubnets(SubnetPlanArgs{
+		VpcCidr:               "10.0.0.0/16",
+		Tiers:                 DefaultSubnetTiers,
+		AvailabilityZoneCount: 3,
+	})
+	if err != nil {
+		t.Fatalf("planning: %v", err)
+	}
+	if got, want := strings.Join(cidrs(plan.Tier("public")), " "), "10.0.0.0/24 10.0.1.0/24 10.0.2.0/24"; got != want {
+		t.Errorf("public subnets = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(cidrs(plan.Tier("private")), " "), "10.0.3.0/24 10.0.4.0/24 10.0.5.0/24"; got != want {
+		t.Errorf("private subnets = %s, want %s", got, want)
+	}
+}
+
+func TestPlanSubnetsMixedSizesAndReservedRanges(t *testing.T) {
+	plan, err := PlanSubnets(SubnetPlanArgs{
+		VpcCidr: "10.1.0.0/20",
+		Tiers: []SubnetTier{
+			{Name: "public", PrefixLength: 26, Public: true},
+			{Name: "private-app", PrefixLength: 23},
+			{Name: "private-db", PrefixLength: 27},
+		},
+		AvailabilityZoneCount: 2,
+		ReservedCidrs:         []string{"10.1.0.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("planning: %v", err)
+	}
+	want := map[string]string{
+		"public":      "10.1.1.0/26 10.1.1.64/26",
+		"private-app": "10.1.2.0/23 10.1.4.0/23",
+		"private-db":  "10.1.1.128/27 10.1.1.160/27",
+	}
+	for tier, blocks := range want {
+		if got := strings.Join(cidrs(plan.Tier(tier)), " "); got != blocks {
+			t.Errorf("%s subnets = %s, want %s", tier, got, blocks)
+		}
+	}
+}
+
+func TestPlanSubnetsIsDeterministic(t *testing.T) {
+	args := SubnetPlanArgs{
+		VpcCidr: "172.16.0.0/16",
+		Tiers: []SubnetTier{
+			{Name: "public", PrefixLength: 24, Public: true},
+			{Name: "private", PrefixLength: 22},
+		},
+		AvailabilityZoneCount: 3,
+	}
+	first, err := PlanSubnets(args)
+	if err != nil {
+		t.Fatalf("planning: %v", err)
+	}
+	second, _ := PlanSubnets(args)
+	if strings.Join(cidrs(first.Allocations), " ") != strings.Join(cidrs(second.Allocations), " ") {
+		t.Errorf("plans differ:\n%v\n%v", first.Allocations, second.Allocations)
+	}
+}
+
+func TestPlanSubnetsPinnedCidrs(t *testing.T) {
+	plan, err := PlanSubnets(SubnetPlanArgs{
+		VpcCidr: "10.0.0.0/16",
+		Tiers: []SubnetTier{
+			{Name: "public", PrefixLength: 24, Public: true},
+			{Name: "private", PrefixLength: 24, Cidrs: []string{"10.0.0.0/24", "10.0.8.0/24"}},
+		},
+		AvailabilityZoneCount: 2,
+	})
+	if err != nil {
+		t.Fatalf("planning: %v", err)
+	}
+	if got, want := strings.Join(cidrs(plan.Tier("public")), " "), "10.0.1.0/24 10.0.2.0/24"; got != want {
+		t.Errorf("public subnets = %s, want %s around the pinned ones", got, want)
+	}
+	if got, want := strings.Join(cidrs(plan.Tier("private")), " "), "10.0.0.0/24 10.0.8.0/24"; got != want {
+		t.Errorf("private subnets = %s, want the pinned %s", got, want)
+	}
+}
+
+func TestPlanSubnetsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args SubnetPlanArgs
+		want string
+	}{
+		{
+			name: "invalid VPC",
+			args: SubnetPlanArgs{VpcCidr: "10.0.0/16", Tiers: DefaultSubnetTiers, AvailabilityZoneCount: 2},
+			want: "is not an IPv4 CIDR block",
+		},
+		{
+			name: "exhausted",
+			args: SubnetPlanArgs{VpcCidr: "10.0.0.0/23", Tiers: DefaultSubnetTiers, AvailabilityZoneCount: 2},
+			want: "has no free /24 left for subnet private-1",
+		},
+		{
+			name: "tier larger than VPC",
+			args: SubnetPlanArgs{
+				VpcCidr:               "10.0.0.0/24",
+				Tiers:                 []SubnetTier{{Name: "public", PrefixLength: 16}},
+				AvailabilityZoneCount: 2,
+			},
+			want: "has prefix length /16",
+		},
+		{
+			name: "pinned overlaps reserved",
+			args: SubnetPlanArgs{
+				VpcCidr:               "10.0.0.0/16",
+				Tiers:                 []SubnetTier{{Name: "public", PrefixLength: 24, Cidrs: []string{"10.0.0.0/24", "10.0.1.0/24"}}},
+				AvailabilityZoneCount: 2,
+				ReservedCidrs:         []string{"10.0.1.0/25"},
+			},
+			want: "subnet public-2 10.0.1.0/24 overlaps reserved range 10.0.1.0/25",
+		},
+		{
+			name: "pinned outside VPC",
+			args: SubnetPlanArgs{
+				VpcCidr:               "10.0.0.0/16",
+				Tiers:                 []SubnetTier{{Name: "public", PrefixLength: 24, Cidrs: []string{"10.0.0.0/24", "10.1.0.0/24"}}},
+				AvailabilityZoneCount: 2,
+			},
+			want: "is outside the VPC",
+		},
+		{
+			name: "duplicate tier",
+			args: SubnetPlanArgs{
+				VpcCidr:               "10.0.0.0/16",
+				Tiers:                 []SubnetTier{{Name: "app", PrefixLength: 24}, {Name: "app", PrefixLength: 24}},
+				AvailabilityZoneCount: 2,
+			},
+			want: `subnet tier "app" is defined twice`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := PlanSubnets(test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestIpv6SubnetCidr(t *testing.T) {
+	for index, want := range map[int]string{
+		0:   "2600:1f18:abcd:ef00::/64",
+		1:   "2600:1f18:abcd:ef01::/64",
+		255: "2600:1f18:abcd:efff::/64",
+	} {
+		got, err := Ipv6SubnetCidr("2600:1f18:abcd:ef00::/56", index)
+		if err != nil || got != want {
+			t.Errorf("subnet %d = %q, %v, want %s", index, got, err, want)
+		}
+	}
+	if _, err := Ipv6SubnetCidr("2600:1f18:abcd:ef00::/56", 256); err == nil {
+		t.Errorf("expected a /56 to have no 257th /64")
+	}
+	if _, err := Ipv6SubnetCidr("10.0.0.0/16", 0); err == nil {
+		t.Errorf("expected an IPv4 block to fail")
+	}
+}
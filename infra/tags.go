@@ -0,0 +1,160 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-gcp/sdk/v6/go/gcp/serviceaccount"
+	"github.com/pulumi/pulumi-gcp/sdk/v6/go/gcp/storage"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultTags are the cost allocation tags applied to every resource of the
+// stack.
+type DefaultTags struct {
+	Project    string
+	Stack      string
+	Owner      string
+	CostCenter string
+	// Extra holds any additional tags, keyed by AWS tag key.
+	Extra map[string]string
+}
+
+// AwsTags returns the tags for AWS resources. Empty values are left out.
+func (t DefaultTags) AwsTags() map[string]string {
+	tags := map[string]string{}
+	for key, value := range t.Extra {
+		tags[key] = value
+	}
+	for key, value := range map[string]string{
+		"Project":    t.Project,
+		"Stack":      t.Stack,
+		"Owner":      t.Owner,
+		"CostCenter": t.CostCenter,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// invalidLabelChars matches the characters GCP does not allow in labels.
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// labelKeyBoundary matches the start of a word in a CamelCase tag key.
+var labelKeyBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// GcpLabels returns the tags as GCP labels, which only allow lowercase
+// letters, digits, underscores and dashes and at most 63 characters. Tag keys
+// such as CostCenter become cost-center.
+func (t DefaultTags) GcpLabels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range t.AwsTags() {
+		key = labelKeyBoundary.ReplaceAllString(key, "$1-$2")
+		labels[toLabel(key)] = toLabel(value)
+	}
+	return labels
+}
+
+func toLabel(value string) string {
+	label := invalidLabelChars.ReplaceAllString(strings.ToLower(value), "_")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
+
+// description renders the tags as text for resources that do not support
+// labels.
+func (t DefaultTags) description() string {
+	labels := t.GcpLabels()
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// RegisterDefaultTags registers a stack transformation that adds the tags
+// to resources the AWS provider's default tags do not reach: the tags the
+// auto scaling group propagates to its instances, the labels of GCS buckets
+// and the description of GCP service accounts, which have no labels. Tags
+// and labels set on a resource take precedence.
+func RegisterDefaultTags(ctx *pulumi.Context, tags DefaultTags) error {
+	return ctx.RegisterStackTransformation(func(args *pulumi.ResourceTransformationArgs) *pulumi.ResourceTransformationResult {
+		switch props := args.Props.(type) {
+		case *autoscaling.GroupArgs:
+			props.Tags = withGroupTags(props.Tags, tags.AwsTags())
+		case *storage.BucketArgs:
+			props.Labels = withLabels(props.Labels, tags.GcpLabels())
+		case *serviceaccount.AccountArgs:
+			if props.Description == nil {
+				props.Description = pulumi.String(fmt.Sprintf("Labels: %s", tags.description()))
+			}
+		default:
+			return nil
+		}
+		return &pulumi.ResourceTransformationResult{Props: args.Props, Opts: args.Opts}
+	})
+}
+
+// withGroupTags appends the default tags that are not already set to the
+// tags of an auto scaling group.
+func withGroupTags(input autoscaling.GroupTagArrayInput, defaults map[string]string) autoscaling.GroupTagArrayInput {
+	var groupTags autoscaling.GroupTagArray
+	if input != nil {
+		existing, ok := input.(autoscaling.GroupTagArray)
+		if !ok {
+			return input
+		}
+		groupTags = append(groupTags, existing...)
+	}
+	set := map[string]bool{}
+	for _, tag := range groupTags {
+		if args, ok := tag.(*autoscaling.GroupTagArgs); ok {
+			if key, ok := args.Key.(pulumi.String); ok {
+				set[string(key)] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if set[key] {
+			continue
+		}
+		groupTags = append(groupTags, &autoscaling.GroupTagArgs{
+			Key:               pulumi.String(key),
+			Value:             pulumi.String(defaults[key]),
+			PropagateAtLaunch: pulumi.Bool(true),
+		})
+	}
+	return groupTags
+}
+
+// withLabels merges the default labels under the labels of a resource.
+func withLabels(input pulumi.StringMapInput, defaults map[string]string) pulumi.StringMapInput {
+	labels := pulumi.ToStringMap(defaults)
+	if input == nil {
+		return labels
+	}
+	existing, ok := input.(pulumi.StringMap)
+	if !ok {
+		return input
+	}
+	for key, value := range existing {
+		labels[key] = value
+	}
+	return labels
+}
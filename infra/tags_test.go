@@ -0,0 +1,28 @@
+package infra
+
+import (
+	"testing"
+)
+
+func TestDefaultTagsGcpLabels(t *testing.T) {
+	tags := DefaultTags{
+		Project:    "iac-pulumi",
+		Stack:      "Dev",
+		CostCenter: "CSYE 6225",
+		Extra:      map[string]string{"DataClassification": "internal"},
+	}
+	labels := tags.GcpLabels()
+	for key, value := range map[string]string{
+		"project":             "iac-pulumi",
+		"stack":               "dev",
+		"cost-center":         "csye_6225",
+		"data-classification": "internal",
+	} {
+		if labels[key] != value {
+			t.Errorf("label %s = %q, want %q", key, labels[key], value)
+		}
+	}
+	if _, ok := labels["owner"]; ok {
+		t.Errorf("an empty owner should not be labelled")
+	}
+}
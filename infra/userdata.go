@@ -0,0 +1,170 @@
+package infra
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strings"
+)
+
+// CloudConfig is the user data of an instance, rendered as a cloud-init
+// document. Its files and environment files are written first, then its
+// commands run in order.
+type CloudConfig struct {
+	Files    []ConfigFile
+	EnvFiles []EnvFile
+	// Commands are run without a shell, one argument per element.
+	Commands [][]string
+}
+
+// ConfigFile is a file written as-is, such as a configuration of the
+// CloudWatch agent.
+type ConfigFile struct {
+	Path        string
+	Permissions string
+	Content     string
+}
+
+// EnvFile is a file of NAME=value lines read by the application.
+type EnvFile struct {
+	Path string
+	// Owner is the user:group of the file, Permissions its octal mode.
+	Owner       string
+	Permissions string
+	// Append adds the variables to the file shipped with the image instead of
+	// replacing it.
+	Append bool
+	Vars   []EnvVar
+}
+
+// EnvVar is a variable of an environment file. When FromCommand is set,
+// Value is a shell command and the variable gets its output when the
+// instance boots, which keeps secrets out of the user data.
+type EnvVar struct {
+	Name        string
+	Value       pulumi.StringInput
+	FromCommand bool
+}
+
+// envVarName matches the names accepted for environment variables.
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// bareEnvValue matches the values written to an environment file without
+// quotes.
+var bareEnvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@,+=-]*$`)
+
+// appendFromCommand is the boot command that appends a variable with the
+// output of a command to an environment file. The output is single quoted,
+// with its own single quotes escaped, so that passwords with any character
+// read back as-is. Nothing is appended when the command fails.
+const appendFromCommand = `value="$(%s)" && printf '%%s=%%s\n' %s "'$(printf '%%s' "$value" | sed "s/'/'\\\\''/g")'" >> %s`
+
+// cloudConfigDocument and cloudConfigFile are the parts of the cloud-init
+// format the stack uses.
+type cloudConfigDocument struct {
+	WriteFiles []cloudConfigFile `yaml:"write_files,omitempty"`
+	Runcmd     [][]string        `yaml:"runcmd,omitempty"`
+}
+
+type cloudConfigFile struct {
+	Path        string `yaml:"path"`
+	Owner       string `yaml:"owner,omitempty"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Append      bool   `yaml:"append,omitempty"`
+	Content     string `yaml:"content"`
+}
+
+// Render resolves the values of every environment file together and renders
+// the document once all of them are known.
+func (c *CloudConfig) Render() pulumi.StringOutput {
+	var inputs []interface{}
+	for _, file := range c.EnvFiles {
+		for _, v := range file.Vars {
+			inputs = append(inputs, v.Value)
+		}
+	}
+	return pulumi.All(inputs...).ApplyT(func(resolved []interface{}) (string, error) {
+		values := make([]string, len(resolved))
+		for i, value := range resolved {
+			values[i] = value.(string)
+		}
+		return c.render(values)
+	}).(pulumi.StringOutput)
+}
+
+// render writes the document with values, the resolved values of the
+// variables in order.
+func (c *CloudConfig) render(values []string) (string, error) {
+	var document cloudConfigDocument
+	var bootCommands [][]string
+	for _, file := range c.Files {
+		document.WriteFiles = append(document.WriteFiles, cloudConfigFile{
+			Path:        file.Path,
+			Permissions: file.Permissions,
+			Content:     file.Content,
+		})
+	}
+	for _, file := range c.EnvFiles {
+		var content strings.Builder
+		for _, v := range file.Vars {
+			if !envVarName.MatchString(v.Name) {
+				return "", fmt.Errorf("%s: %q is not a valid variable name", file.Path, v.Name)
+			}
+			if len(values) == 0 {
+				return "", fmt.Errorf("%s: no value for %s", file.Path, v.Name)
+			}
+			value := values[0]
+			values = values[1:]
+			if v.FromCommand {
+				// Append the value once the instance has computed it
+				bootCommands = append(bootCommands, []string{"sh", "-c", fmt.Sprintf(
+					appendFromCommand, value, v.Name, shellQuote(file.Path),
+				)})
+				continue
+			}
+			value, err := quoteEnvValue(value)
+			if err != nil {
+				return "", fmt.Errorf("%s: %s %v", file.Path, v.Name, err)
+			}
+			fmt.Fprintf(&content, "%s=%s\n", v.Name, value)
+		}
+		document.WriteFiles = append(document.WriteFiles, cloudConfigFile{
+			Path:        file.Path,
+			Owner:       file.Owner,
+			Permissions: file.Permissions,
+			Append:      file.Append,
+			Content:     content.String(),
+		})
+	}
+	document.Runcmd = append(bootCommands, c.Commands...)
+
+	var rendered strings.Builder
+	rendered.WriteString("#cloud-config\n")
+	encoder := yaml.NewEncoder(&rendered)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// quoteEnvValue returns the value as written to an environment file: as-is
+// when it only has safe characters, in single quotes otherwise.
+func quoteEnvValue(value string) (string, error) {
+	if bareEnvValue.MatchString(value) {
+		return value, nil
+	}
+	if strings.ContainsAny(value, "'\n") {
+		return "", fmt.Errorf("value cannot contain a single quote or a newline")
+	}
+	return "'" + value + "'", nil
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,160 @@
+package infra
+
+import (
+	"flag"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with testdata/<name>.golden, or rewrites the file
+// when the tests run with -update.
+func checkGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match:\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func TestCloudConfigRender(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config CloudConfig
+		values []string
+	}{
+		{
+			name: "userdata-webapp",
+			config: CloudConfig{
+				Files: []ConfigFile{{
+					Path:        "/opt/aws/amazon-cloudwatch-agent/etc/application-logs.json",
+					Permissions: "0644",
+					Content:     `{"logs":{}}`,
+				}},
+				EnvFiles: []EnvFile{{
+					Path:        "/opt/app/.env",
+					Owner:       "webapp:csye6225",
+					Permissions: "0640",
+					Append:      true,
+					Vars: []EnvVar{
+						{Name: "DB_HOST"},
+						{Name: "DB_PASSWORD", FromCommand: true},
+						{Name: "SUBMISSION_TOPIC_ARN"},
+					},
+				}},
+				Commands: [][]string{
+					{"chown", "webapp:csye6225", "/opt/app/assessment-application"},
+				},
+			},
+			values: []string{
+				"database.example.internal",
+				"aws secretsmanager get-secret-value --secret-id db --query SecretString --output text",
+				"arn:aws:sns:us-east-1:123456789012:topic",
+			},
+		},
+		{
+			name: "userdata-quoting",
+			config: CloudConfig{
+				EnvFiles: []EnvFile{{
+					Path: "/etc/app env",
+					Vars: []EnvVar{
+						{Name: "PLAIN"},
+						{Name: "SPACES"},
+						{Name: "SHELL"},
+						{Name: "EMPTY"},
+						{Name: "FROM_FILE", FromCommand: true},
+					},
+				}},
+			},
+			values: []string{"a-b_c.d/e:f@g", "two words", "$HOME `id` # not a comment", "", "cat '/etc/app secret'"},
+		},
+		{
+			name: "userdata-secret",
+			config: CloudConfig{
+				EnvFiles: []EnvFile{{
+					Path: "/opt/app/.env",
+					Vars: []EnvVar{{Name: "DB_PASSWORD", FromCommand: true}},
+				}},
+			},
+			values: []string{`printf '%s' 'pa$$word #1'\''s secret'`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.config.render(test.values)
+			if err != nil {
+				t.Fatalf("rendering: %v", err)
+			}
+			checkGolden(t, test.name, got)
+		})
+	}
+}
+
+func TestCloudConfigRenderQuotesCommandOutput(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the boot commands")
+	}
+	password := `pa$$word #1's secret`
+	path := filepath.Join(t.TempDir(), "app env")
+	config := CloudConfig{EnvFiles: []EnvFile{{
+		Path: path,
+		Vars: []EnvVar{{Name: "DB_PASSWORD", FromCommand: true}},
+	}}}
+	rendered, err := config.render([]string{"printf '%s' " + shellQuote(password)})
+	if err != nil {
+		t.Fatalf("rendering: %v", err)
+	}
+	var document cloudConfigDocument
+	if err := yaml.Unmarshal([]byte(rendered), &document); err != nil {
+		t.Fatalf("parsing the document: %v", err)
+	}
+	for _, command := range document.Runcmd {
+		if out, err := exec.Command(command[0], command[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("running %v: %v\n%s", command, err, out)
+		}
+	}
+
+	// The environment file must read back the password as-is
+	out, err := exec.Command("sh", "-c", `. "$0" && printf '%s' "$DB_PASSWORD"`, path).Output()
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if string(out) != password {
+		t.Errorf("DB_PASSWORD = %q, want %q", out, password)
+	}
+}
+
+func TestCloudConfigRenderRejectsUnsafeValues(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		vars   []EnvVar
+		values []string
+		want   string
+	}{
+		{"single quote", []EnvVar{{Name: "QUOTE"}}, []string{"it's"}, "cannot contain a single quote"},
+		{"newline", []EnvVar{{Name: "LINES"}}, []string{"a\nb"}, "cannot contain a single quote or a newline"},
+		{"name", []EnvVar{{Name: "BAD-NAME"}}, []string{"value"}, "not a valid variable name"},
+		{"missing value", []EnvVar{{Name: "MISSING"}}, nil, "no value for MISSING"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := CloudConfig{EnvFiles: []EnvFile{{Path: "/opt/app/.env", Vars: test.vars}}}
+			_, err := config.render(test.values)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
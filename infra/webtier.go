@@ -0,0 +1,722 @@
+package infra
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/alb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rootDeviceName is the root device of the Amazon Linux images the
+// application is built on.
+const rootDeviceName = "/dev/xvda"
+
+// cloudwatchAgentCtl is the control script of the CloudWatch agent of the
+// image, and applicationLogsConfigFile the agent configuration the user data
+// writes to ship the application log to its log group.
+const (
+	cloudwatchAgentCtl        = "/opt/aws/amazon-cloudwatch-agent/bin/amazon-cloudwatch-agent-ctl"
+	applicationLogsConfigFile = "/opt/aws/amazon-cloudwatch-agent/etc/application-logs.json"
+)
+
+// ApplicationArgs describes how the web application is laid out on the
+// instance image.
+type ApplicationArgs struct {
+	User                 string
+	UserGroup            string
+	Port                 int
+	ResourceFile         string
+	PropertyFile         string
+	LogFile              string
+	CloudwatchConfigFile string
+	BinaryFile           string
+	HealthCheckPath      string
+}
+
+// DatabaseConnectionArgs holds the settings the application uses to connect
+// to its database.
+type DatabaseConnectionArgs struct {
+	Address pulumi.StringOutput
+	Port    pulumi.IntOutput
+	User    string
+	// PasswordSecretArn is the secret the instances read the password from
+	// at boot, so that it is never part of the user data.
+	PasswordSecretArn pulumi.StringOutput
+	// PasswordVersionId is written next to the password, so that a new
+	// password changes the launch template and refreshes the instances.
+	PasswordVersionId pulumi.StringOutput
+	Name              string
+}
+
+// WebTierArgs configures the auto scaling group and its load balancer.
+type WebTierArgs struct {
+	VpcId  pulumi.StringInput
+	Region string
+	// LoadBalancerSubnetIds are the public subnets of the load balancer.
+	LoadBalancerSubnetIds pulumi.StringArray
+	// InstanceSubnetIds are the subnets the auto scaling group launches
+	// instances in. PrivateInstances must be set when they are private, in
+	// which case instances get no public IP and need a NAT to reach AWS.
+	InstanceSubnetIds pulumi.StringArray
+	PrivateInstances  bool
+	// DualStack serves the load balancer over IPv4 and IPv6. Its subnets
+	// must have IPv6 blocks.
+	DualStack                   bool
+	SecurityGroupId             pulumi.StringInput
+	LoadBalancerSecurityGroupId pulumi.StringInput
+	AmiId                       string
+	InstanceType                string
+	// AccessMode is how operators reach the instances: AccessSsm (the
+	// default) through Session Manager, recording the sessions as
+	// SessionLogging says, or AccessSsh with the SshKeyName key pair.
+	AccessMode     string
+	SessionLogging SessionLogging
+	SshKeyName     string
+	// RootVolumeSize is the size in GiB of the instance root volume. Zero keeps
+	// the volume defined by the AMI.
+	RootVolumeSize int
+	RootVolumeType string
+	// DomainName is the record pointed at the load balancer, created in the
+	// hosted zone ZoneId.
+	DomainName string
+	ZoneId     pulumi.StringInput
+	// Aliases are other names in the hosted zone that point at the load
+	// balancer. An issued certificate covers them too.
+	Aliases []string
+	// CertificateMode is how the certificate of DomainName is obtained:
+	// CertificateLookup (the default) expects an issued certificate, while
+	// CertificateIssue requests one with SubjectAlternativeNames from ACM.
+	CertificateMode         string
+	SubjectAlternativeNames []string
+	// Listeners are the ports of the load balancer. Defaults to
+	// DefaultListeners.
+	Listeners []Listener
+	// SslPolicy is the TLS security policy of the HTTPS listeners that do not
+	// set their own. The AWS default is used when it is empty.
+	SslPolicy string
+	App       ApplicationArgs
+	Database  DatabaseConnectionArgs
+	// TopicArn is written to the environment file of the instances. Like
+	// every output in the user data, it is resolved before the launch
+	// template is rendered.
+	TopicArn pulumi.StringOutput
+	Names    NameTags
+}
+
+// WebTier is an auto scaling group of application instances behind an HTTPS
+// application load balancer.
+type WebTier struct {
+	pulumi.ResourceState
+
+	LoadBalancer     *lb.LoadBalancer
+	AutoScalingGroup *autoscaling.Group
+	LoadBalancerDns  pulumi.StringOutput
+	// SessionDocument is the document to open recorded sessions with. It is
+	// nil unless sessions are logged.
+	SessionDocument *ssm.Document
+}
+
+// NewWebTier creates the instance role, launch template, auto scaling group,
+// scaling alarms, load balancer, listener and DNS record.
+func NewWebTier(ctx *pulumi.Context, name string, args *WebTierArgs, opts ...pulumi.ResourceOption) (*WebTier, error) {
+	webTier := &WebTier{}
+	err := ctx.RegisterComponentResource("iac-pulumi:infra:WebTier", name, webTier, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := args.Names
+	app := args.App
+	listeners := args.Listeners
+	if len(listeners) == 0 {
+		listeners = DefaultListeners
+	}
+	db := args.Database
+
+	// The agent configuration of the image is extended to ship the
+	// application log to the log group of the stack
+	_, err = cloudwatch.NewLogGroup(ctx, names.ApplicationLogGroupName, &cloudwatch.LogGroupArgs{
+		Name: pulumi.String(names.ApplicationLogGroupName),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.ApplicationLogGroupName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+	logsConfig, err := json.Marshal(map[string]interface{}{
+		"logs": map[string]interface{}{
+			"logs_collected": map[string]interface{}{
+				"files": map[string]interface{}{
+					"collect_list": []map[string]interface{}{
+						{
+							"file_path":       app.LogFile,
+							"log_group_name":  names.ApplicationLogGroupName,
+							"log_stream_name": "{instance_id}",
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the environment of the application and start the cloudwatch agent
+	userData := &CloudConfig{
+		Files: []ConfigFile{
+			{Path: applicationLogsConfigFile, Permissions: "0644", Content: string(logsConfig)},
+		},
+		EnvFiles: []EnvFile{
+			{
+				Path:        app.PropertyFile,
+				Owner:       app.User + ":" + app.UserGroup,
+				Permissions: "0640",
+				Append:      true,
+				Vars: []EnvVar{
+					{Name: "DB_HOST", Value: db.Address},
+					{Name: "DB_PORT", Value: pulumi.Sprintf("%d", db.Port)},
+					{Name: "DB_USER", Value: pulumi.String(db.User)},
+					{Name: "DB_PASSWORD", FromCommand: true, Value: pulumi.Sprintf(
+						`aws secretsmanager get-secret-value --region %s --secret-id %s --query SecretString --output text | python3 -c 'import json, sys; print(json.load(sys.stdin)["password"])'`,
+						args.Region, db.PasswordSecretArn,
+					)},
+					{Name: "DB_PASSWORD_VERSION", Value: db.PasswordVersionId},
+					{Name: "DB_NAME", Value: pulumi.String(db.Name)},
+					{Name: "PORT", Value: pulumi.String(strconv.Itoa(app.Port))},
+					{Name: "FILE_PATH", Value: pulumi.String(app.ResourceFile)},
+					{Name: "LOG_FILE_PATH", Value: pulumi.String(app.LogFile)},
+					{Name: "SUBMISSION_TOPIC_ARN", Value: args.TopicArn},
+					{Name: "AWS_REGION", Value: pulumi.String(args.Region)},
+				},
+			},
+		},
+		Commands: [][]string{
+			{"chown", app.User + ":" + app.UserGroup, app.BinaryFile},
+			{"chown", app.User + ":" + app.UserGroup, app.ResourceFile},
+			{cloudwatchAgentCtl, "-a", "fetch-config", "-m", "ec2", "-c", "file:" + app.CloudwatchConfigFile},
+			{cloudwatchAgentCtl, "-a", "append-config", "-m", "ec2", "-c", "file:" + applicationLogsConfigFile, "-s"},
+		},
+	}
+
+	// Create a Default Role Policy
+	policyString, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			map[string]interface{}{
+				"Action": "sts:AssumeRole",
+				"Effect": "Allow",
+				"Sid":    "",
+				"Principal": map[string]interface{}{
+					"Service": "ec2.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defaultPolicy := string(policyString)
+
+	// Create a new Role for the cloudwatch agent
+	role, err := iam.NewRole(ctx, names.CloudwatchAgentRoleName, &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(defaultPolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.CloudwatchAgentRoleName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new IAM instance profile with cloudwatch agent role.
+	instanceProfile, err := iam.NewInstanceProfile(ctx, names.CloudwatchInstanceProfileName, &iam.InstanceProfileArgs{
+		Role: role.Name,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.CloudwatchInstanceProfileName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the account of the log group ARNs
+	identity, err := aws.GetCallerIdentity(ctx, nil, pulumi.Parent(webTier))
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the cloudwatch agent write the application logs and the metrics
+	_, err = iam.NewRolePolicy(ctx, names.CloudwatchAgentPolicyName, &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: policyDocument(
+			policyStatement{
+				Sid: "WriteApplicationLogs",
+				Actions: []string{
+					"logs:CreateLogStream",
+					"logs:DescribeLogStreams",
+					"logs:PutLogEvents",
+				},
+				Resources: []pulumi.StringInput{
+					logGroupArn(args.Region, identity.AccountId, pulumi.String(names.ApplicationLogGroupName)),
+				},
+			},
+			// Metrics and instance tags cannot be scoped to a resource
+			policyStatement{
+				Sid: "PublishMetrics",
+				Actions: []string{
+					"cloudwatch:PutMetricData",
+					"ec2:DescribeTags",
+					"ec2:DescribeVolumes",
+				},
+				Resources: []pulumi.StringInput{pulumi.String("*")},
+			},
+		),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the application publish submissions to the topic
+	_, err = iam.NewRolePolicy(ctx, names.SnsPolicyName, &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: policyDocument(policyStatement{
+			Sid:       "PublishSubmissions",
+			Actions:   []string{"sns:Publish"},
+			Resources: []pulumi.StringInput{args.TopicArn},
+		}),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the instances read the database password at boot
+	_, err = iam.NewRolePolicy(ctx, names.DatabaseSecretPolicyName, &iam.RolePolicyArgs{
+		Role: role.Name,
+		Policy: policyDocument(policyStatement{
+			Sid:       "ReadDatabaseCredentials",
+			Actions:   []string{"secretsmanager:GetSecretValue"},
+			Resources: []pulumi.StringInput{db.PasswordSecretArn},
+		}),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let operators in through Session Manager, or with the key pair
+	var keyName pulumi.StringPtrInput
+	if args.AccessMode == AccessSsh {
+		keyName = pulumi.String(args.SshKeyName)
+	} else {
+		webTier.SessionDocument, err = newSessionManager(ctx, webTier, &sessionManagerArgs{
+			Role:      role,
+			Region:    args.Region,
+			AccountId: identity.AccountId,
+			Logging:   args.SessionLogging,
+			Names:     names,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Override the root volume of the AMI when a size is configured
+	var blockDeviceMappings ec2.LaunchTemplateBlockDeviceMappingArray
+	if args.RootVolumeSize > 0 {
+		blockDeviceMappings = append(blockDeviceMappings, &ec2.LaunchTemplateBlockDeviceMappingArgs{
+			DeviceName: pulumi.String(rootDeviceName),
+			Ebs: &ec2.LaunchTemplateBlockDeviceMappingEbsArgs{
+				VolumeSize:          pulumi.Int(args.RootVolumeSize),
+				VolumeType:          pulumi.String(args.RootVolumeType),
+				DeleteOnTermination: pulumi.String("true"),
+			},
+		})
+	}
+
+	// Private instances get an explicit network interface so that they never
+	// receive a public IP, whatever the subnet maps on launch
+	var securityGroupIds pulumi.StringArrayInput = pulumi.StringArray{args.SecurityGroupId}
+	var networkInterfaces ec2.LaunchTemplateNetworkInterfaceArray
+	if args.PrivateInstances {
+		networkInterfaces = append(networkInterfaces, &ec2.LaunchTemplateNetworkInterfaceArgs{
+			AssociatePublicIpAddress: pulumi.String("false"),
+			DeleteOnTermination:      pulumi.String("true"),
+			SecurityGroups:           securityGroupIds,
+		})
+		securityGroupIds = nil
+	}
+
+	// Create an ec2 launch template
+	ec2LaunchTemplate, err := ec2.NewLaunchTemplate(ctx, names.Ec2LaunchTemplateName, &ec2.LaunchTemplateArgs{
+		Name:                  pulumi.String(names.Ec2LaunchTemplateName),
+		ImageId:               pulumi.String(args.AmiId),
+		InstanceType:          pulumi.String(args.InstanceType),
+		KeyName:               keyName,
+		DisableApiTermination: pulumi.Bool(false),
+		VpcSecurityGroupIds:   securityGroupIds,
+		NetworkInterfaces:     networkInterfaces,
+		BlockDeviceMappings:   blockDeviceMappings,
+		UserData: userData.Render().ApplyT(func(userData string) string {
+			return base64.StdEncoding.EncodeToString([]byte(userData))
+		}).(pulumi.StringOutput),
+		IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileArgs{
+			Name: instanceProfile.Name,
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.Ec2LaunchTemplateName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a Target Group
+	targetGroup, err := alb.NewTargetGroup(ctx, names.TargetGroupName, &alb.TargetGroupArgs{
+		Port:       pulumi.Int(app.Port),
+		Protocol:   pulumi.String("HTTP"),
+		TargetType: pulumi.String("instance"),
+		VpcId:      args.VpcId,
+		HealthCheck: &alb.TargetGroupHealthCheckArgs{
+			Enabled:  pulumi.Bool(true),
+			Interval: pulumi.Int(60),
+			Path:     pulumi.String(app.HealthCheckPath),
+			Port:     pulumi.String(strconv.Itoa(app.Port)),
+			Protocol: pulumi.String("HTTP"),
+			Timeout:  pulumi.Int(5),
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.TargetGroupName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	autoScalingGroup, err := autoscaling.NewGroup(ctx, names.AutoScalingGroupName, &autoscaling.GroupArgs{
+		Name:                   pulumi.String(names.AutoScalingGroupName),
+		VpcZoneIdentifiers:     args.InstanceSubnetIds,
+		DesiredCapacity:        pulumi.Int(1),
+		MaxSize:                pulumi.Int(3),
+		MinSize:                pulumi.Int(1),
+		DefaultCooldown:        pulumi.Int(60),
+		HealthCheckType:        pulumi.String("ELB"),
+		HealthCheckGracePeriod: pulumi.Int(10),
+		// Pin the version of the launch template, so that a new one, such as
+		// for a new database password, replaces the running instances
+		LaunchTemplate: &autoscaling.GroupLaunchTemplateArgs{
+			Id:      ec2LaunchTemplate.ID(),
+			Version: pulumi.Sprintf("%d", ec2LaunchTemplate.LatestVersion),
+		},
+		InstanceRefresh: &autoscaling.GroupInstanceRefreshArgs{
+			Strategy: pulumi.String("Rolling"),
+			Preferences: &autoscaling.GroupInstanceRefreshPreferencesArgs{
+				MinHealthyPercentage: pulumi.Int(50),
+			},
+		},
+		Tags: autoscaling.GroupTagArray{
+			&autoscaling.GroupTagArgs{
+				Key:               pulumi.String("Name"),
+				Value:             pulumi.String(names.ApplicationInstanceName),
+				PropagateAtLaunch: pulumi.Bool(true),
+			},
+		},
+		TargetGroupArns: pulumi.StringArray{targetGroup.Arn},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create scale up policy
+	scaleUpPolicy, err := autoscaling.NewPolicy(ctx, names.ScaleUpPolicyName, &autoscaling.PolicyArgs{
+		AdjustmentType:        pulumi.String("ChangeInCapacity"),
+		ScalingAdjustment:     pulumi.Int(1),
+		MetricAggregationType: pulumi.String("Average"),
+		PolicyType:            pulumi.String("SimpleScaling"),
+		AutoscalingGroupName:  autoScalingGroup.Name,
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create scale down policy
+	scaleDownPolicy, err := autoscaling.NewPolicy(ctx, names.ScaleDownPolicyName, &autoscaling.PolicyArgs{
+		AdjustmentType:        pulumi.String("ChangeInCapacity"),
+		ScalingAdjustment:     pulumi.Int(-1),
+		MetricAggregationType: pulumi.String("Average"),
+		PolicyType:            pulumi.String("SimpleScaling"),
+		AutoscalingGroupName:  autoScalingGroup.Name,
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a CloudWatch Alarm
+	_, err = cloudwatch.NewMetricAlarm(ctx, names.ScaleUpAlarmName, &cloudwatch.MetricAlarmArgs{
+		AlarmDescription:   pulumi.String("Request for the AutoScaling Alarm"),
+		EvaluationPeriods:  pulumi.Int(2),
+		MetricName:         pulumi.String("CPUUtilization"),
+		Namespace:          pulumi.String("AWS/EC2"),
+		Period:             pulumi.Int(120),
+		Statistic:          pulumi.String("Average"),
+		Threshold:          pulumi.Float64(5),
+		ComparisonOperator: pulumi.String("GreaterThanThreshold"),
+		Dimensions: pulumi.StringMap{
+			"AutoScalingGroupName": autoScalingGroup.Name,
+		},
+		AlarmActions: pulumi.Array{
+			scaleUpPolicy.Arn,
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a CloudWatch Alarm
+	_, err = cloudwatch.NewMetricAlarm(ctx, names.ScaleDownAlarmName, &cloudwatch.MetricAlarmArgs{
+		AlarmDescription:   pulumi.String("Request for the AutoScaling Alarm"),
+		EvaluationPeriods:  pulumi.Int(2),
+		MetricName:         pulumi.String("CPUUtilization"),
+		Namespace:          pulumi.String("AWS/EC2"),
+		Period:             pulumi.Int(120),
+		Statistic:          pulumi.String("Average"),
+		Threshold:          pulumi.Float64(3),
+		ComparisonOperator: pulumi.String("LessThanThreshold"),
+		Dimensions: pulumi.StringMap{
+			"AutoScalingGroupName": autoScalingGroup.Name,
+		},
+		AlarmActions: pulumi.Array{
+			scaleDownPolicy.Arn,
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ipAddressType := "ipv4"
+	if args.DualStack {
+		ipAddressType = "dualstack"
+	}
+
+	//Create a Load Balancer
+	loadBalancer, err := lb.NewLoadBalancer(ctx, names.LoadBalancerName, &lb.LoadBalancerArgs{
+		Internal:                 pulumi.Bool(false),
+		LoadBalancerType:         pulumi.String("application"),
+		IpAddressType:            pulumi.String(ipAddressType),
+		Subnets:                  args.LoadBalancerSubnetIds,
+		SecurityGroups:           pulumi.StringArray{args.LoadBalancerSecurityGroupId},
+		EnableDeletionProtection: pulumi.Bool(false),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(names.LoadBalancerName),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Issue the certificate of the application domain when configured
+	certificateArns := map[string]pulumi.StringInput{}
+	if args.CertificateMode == CertificateIssue {
+		issued, err := newValidatedCertificate(ctx, webTier, &validatedCertificateArgs{
+			DomainName:              args.DomainName,
+			SubjectAlternativeNames: subjectAlternativeNames(args.SubjectAlternativeNames, args.Aliases),
+			ZoneId:                  args.ZoneId,
+			Names:                   names,
+		})
+		if err != nil {
+			return nil, err
+		}
+		certificateArns[args.DomainName] = issued
+	}
+
+	// Look up every other certificate once, keyed by domain or ARN
+	certificateArn := func(certificate string) (pulumi.StringInput, error) {
+		if certificate == "" {
+			certificate = args.DomainName
+		}
+		if strings.HasPrefix(certificate, "arn:") {
+			return pulumi.String(certificate), nil
+		}
+		if arn, ok := certificateArns[certificate]; ok {
+			return arn, nil
+		}
+		issued, err := acm.LookupCertificate(ctx, &acm.LookupCertificateArgs{
+			Domain: certificate,
+			Statuses: []string{
+				"ISSUED",
+			},
+		}, pulumi.Parent(webTier))
+		if err != nil {
+			return nil, err
+		}
+		certificateArns[certificate] = pulumi.String(issued.Arn)
+		return certificateArns[certificate], nil
+	}
+
+	//Create a Load Balancer Listener for every configured port
+	for _, listener := range listeners {
+		listenerName, err := names.ListenerPortName(listener.Port)
+		if err != nil {
+			return nil, err
+		}
+		listenerArgs := &alb.ListenerArgs{
+			LoadBalancerArn: loadBalancer.Arn,
+			Port:            pulumi.Int(listener.Port),
+			Protocol:        pulumi.String(listener.Protocol),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(listenerName),
+			},
+		}
+		if listener.Protocol == "HTTPS" {
+			arn, err := certificateArn(listener.Certificate)
+			if err != nil {
+				return nil, err
+			}
+			listenerArgs.CertificateArn = arn
+			sslPolicy := listener.SslPolicy
+			if sslPolicy == "" {
+				sslPolicy = args.SslPolicy
+			}
+			if sslPolicy != "" {
+				listenerArgs.SslPolicy = pulumi.String(sslPolicy)
+			}
+		}
+		switch listener.action() {
+		case ListenerForward:
+			listenerArgs.DefaultActions = alb.ListenerDefaultActionArray{
+				&alb.ListenerDefaultActionArgs{
+					Type:           pulumi.String("forward"),
+					TargetGroupArn: targetGroup.Arn,
+				},
+			}
+		case ListenerFixedResponse:
+			listenerArgs.DefaultActions = alb.ListenerDefaultActionArray{
+				&alb.ListenerDefaultActionArgs{
+					Type: pulumi.String("fixed-response"),
+					FixedResponse: &alb.ListenerDefaultActionFixedResponseArgs{
+						ContentType: pulumi.String("text/plain"),
+						StatusCode:  pulumi.String("404"),
+					},
+				},
+			}
+		case ListenerRedirect:
+			target := httpsListener(listeners)
+			if target == nil {
+				return nil, fmt.Errorf("listener on port %d redirects but there is no HTTPS listener", listener.Port)
+			}
+			listenerArgs.DefaultActions = alb.ListenerDefaultActionArray{
+				&alb.ListenerDefaultActionArgs{
+					Type: pulumi.String("redirect"),
+					Redirect: &alb.ListenerDefaultActionRedirectArgs{
+						Port:       pulumi.String(strconv.Itoa(target.Port)),
+						Protocol:   pulumi.String("HTTPS"),
+						StatusCode: pulumi.String("HTTP_301"),
+					},
+				},
+			}
+		default:
+			return nil, fmt.Errorf("listener on port %d has unknown action %q", listener.Port, listener.Action)
+		}
+		albListener, err := alb.NewListener(ctx, listenerName, listenerArgs, childOptions(webTier)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Serve the additional certificates through SNI
+		for i, certificate := range listener.AdditionalCertificates {
+			certificateName, err := names.ListenerCertificateName(listener.Port)
+			if err != nil {
+				return nil, err
+			}
+			arn, err := certificateArn(certificate)
+			if err != nil {
+				return nil, err
+			}
+			_, err = alb.NewListenerCertificate(ctx, names.Indexed(certificateName, i+1), &alb.ListenerCertificateArgs{
+				ListenerArn:    albListener.Arn,
+				CertificateArn: arn,
+			}, childOptions(webTier)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Point the domain and every alias at the load balancer with A records,
+	// and with AAAA records too in dual-stack mode
+	recordTypes := []string{"A"}
+	if args.DualStack {
+		recordTypes = append(recordTypes, "AAAA")
+	}
+	for _, recordType := range recordTypes {
+		recordName, aliasName := names.ApplicationInstanceRecordName, names.AliasRecordName
+		if recordType == "AAAA" {
+			recordName, aliasName = names.ApplicationInstanceIpv6RecordName, names.AliasIpv6RecordName
+		}
+		err = newAliasRecord(ctx, webTier, recordName, args.DomainName, recordType, args.ZoneId, loadBalancer)
+		if err != nil {
+			return nil, err
+		}
+		for i, alias := range args.Aliases {
+			err = newAliasRecord(ctx, webTier, names.Indexed(aliasName, i+1), alias, recordType, args.ZoneId, loadBalancer)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	webTier.LoadBalancer = loadBalancer
+	webTier.AutoScalingGroup = autoScalingGroup
+	webTier.LoadBalancerDns = loadBalancer.DnsName
+
+	if err := ctx.RegisterResourceOutputs(webTier, pulumi.Map{
+		"loadBalancerDns":      loadBalancer.DnsName,
+		"autoScalingGroupName": autoScalingGroup.Name,
+	}); err != nil {
+		return nil, err
+	}
+	return webTier, nil
+}
+
+// newAliasRecord creates a record of the domain in the zone that aliases the
+// load balancer.
+func newAliasRecord(ctx *pulumi.Context, webTier *WebTier, name, domain, recordType string, zoneId pulumi.StringInput, loadBalancer *lb.LoadBalancer) error {
+	_, err := route53.NewRecord(ctx, name, &route53.RecordArgs{
+		Name:   pulumi.String(domain),
+		Type:   pulumi.String(recordType),
+		ZoneId: zoneId,
+		Aliases: route53.RecordAliasArray{
+			&route53.RecordAliasArgs{
+				EvaluateTargetHealth: pulumi.Bool(true),
+				Name:                 loadBalancer.DnsName,
+				ZoneId:               loadBalancer.ZoneId,
+			},
+		},
+		AllowOverwrite: pulumi.Bool(true),
+	}, childOptions(webTier)...)
+	return err
+}
+
+// subjectAlternativeNames returns the SANs followed by the aliases they do not
+// already list.
+func subjectAlternativeNames(sans, aliases []string) []string {
+	result := slices.Clone(sans)
+	for _, alias := range aliases {
+		if !slices.Contains(result, alias) {
+			result = append(result, alias)
+		}
+	}
+	return result
+}
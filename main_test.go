@@ -0,0 +1,1658 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/alb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/dynamodb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sns"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"gopkg.in/yaml.v3"
+	"iac-pulumi/infra"
+	"iac-pulumi/policy/baseline"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testConfig is the stack configuration the program is run with under mocks.
+var testConfig = map[string]string{
+	"application:binaryFile":           "/opt/app/assessment-application",
+	"application:cloudwatchConfigFile": "/opt/aws/amazon-cloudwatch-agent/etc/amazon-cloudwatch-agent.json",
+	"application:domainName":           "example.com",
+	"application:healthCheckPath":      "/healthz",
+	"application:logFile":              "/var/log/webapp/assessment-application.log",
+	"application:port":                 "8080",
+	"application:propertyFile":         "/opt/app/.env",
+	"application:resourceFile":         "/opt/users.csv",
+	"application:user":                 "webapp",
+	"application:userGroup":            "csye6225",
+	"application:gcpProject":           "test-project",
+	"aws:profile":                      "dev",
+	"aws:region":                       "us-east-1",
+	"database:engine":                  "mariadb",
+	"database:engineVersion":           "10.11.5",
+	"database:family":                  "mariadb10.11",
+	"database:instanceClass":           "db.t3.micro",
+	"database:masterUser":              "csye6225",
+	"database:name":                    "cloud",
+	"database:port":                    "3306",
+	"database:storageSize":             "20",
+	"database:storageEncrypted":        "true",
+	"iac-pulumi:amiId":                 "ami-12345678",
+	"iac-pulumi:instanceType":          "t2.micro",
+	"iac-pulumi:costCenter":            "CSYE6225",
+	"iac-pulumi:gitCommit":             "abc1234",
+	"iac-pulumi:owner":                 "platform-team",
+	"iac-pulumi:ipv4Cidr":              "0.0.0.0/0",
+	"iac-pulumi:ipv6Cidr":              "::/0",
+	"iac-pulumi:namingPattern":         "{project}-{stack}-{component}",
+	"iac-pulumi:path":                  "lambda.zip",
+	"iac-pulumi:ports":                 "[22,8080]",
+	"iac-pulumi:rootVolumeSize":        "25",
+	"iac-pulumi:sshKeyName":            "test-key",
+	"iac-pulumi:vpcCidr":               "10.0.0.0/16",
+	"smtp:username":                    "postmaster@example.com",
+	"smtp:key":                         "test-smtp-key",
+}
+
+const (
+	testDatabaseAddress = "database.test.internal"
+	testClusterAddress  = "cluster.test.internal"
+	testTopicArn        = "arn:aws:sns:us-east-1:123456789012:assessment-application-topic"
+	testTableArn        = "arn:aws:dynamodb:us-east-1:123456789012:table/submissions"
+)
+
+// testName is the name the default naming pattern gives a component in the
+// test stack.
+func testName(component string) string {
+	return "iac-pulumi-test-" + component
+}
+
+// mocks stubs the provider calls made by the program and records every
+// resource that is registered.
+type mocks struct {
+	mu        sync.Mutex
+	resources []pulumi.MockResourceArgs
+	// zones are the available availability zones, four when it is nil.
+	zones []string
+	// engineFamily is the parameter group family RDS reports for the
+	// engine version, the one it is named after when it is empty.
+	engineFamily string
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	m.resources = append(m.resources, args)
+	m.mu.Unlock()
+
+	outputs := args.Inputs.Copy()
+	switch args.TypeToken {
+	case "aws:rds/instance:Instance":
+		outputs["address"] = resource.NewStringProperty(testDatabaseAddress)
+		outputs["endpoint"] = resource.NewStringProperty(testDatabaseAddress + ":3306")
+	case "aws:rds/cluster:Cluster":
+		outputs["endpoint"] = resource.NewStringProperty(testClusterAddress)
+		outputs["readerEndpoint"] = resource.NewStringProperty("reader." + testClusterAddress)
+	case "aws:secretsmanager/secret:Secret":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + args.Name)
+	case "random:index/randomPassword:RandomPassword":
+		outputs["result"] = resource.MakeSecret(resource.NewStringProperty("generated-password"))
+	case "aws:secretsmanager/secretVersion:SecretVersion":
+		outputs["versionId"] = resource.NewStringProperty("version-" + args.Name)
+	case "aws:ec2/launchTemplate:LaunchTemplate":
+		outputs["latestVersion"] = resource.NewNumberProperty(2)
+	case "aws:dynamodb/table:Table":
+		outputs["arn"] = resource.NewStringProperty(testTableArn)
+	case "aws:sns/topic:Topic":
+		outputs["arn"] = resource.NewStringProperty(testTopicArn)
+	case "aws:iam/role:Role", "aws:iam/policy:Policy", "aws:lambda/function:Function":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:test::123456789012:" + args.Name)
+		outputs["name"] = resource.NewStringProperty(args.Name)
+	case "aws:ec2/eip:Eip":
+		outputs["publicIp"] = resource.NewStringProperty("203.0.113.10")
+	case "aws:acm/certificate:Certificate":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:acm:us-east-1:123456789012:certificate/issued")
+		var options []interface{}
+		domains := []interface{}{args.Inputs["domainName"].StringValue()}
+		if sans, ok := args.Inputs["subjectAlternativeNames"]; ok {
+			for _, san := range sans.ArrayValue() {
+				domains = append(domains, san.StringValue())
+			}
+		}
+		for _, domain := range domains {
+			base := strings.TrimPrefix(domain.(string), "*.")
+			options = append(options, map[string]interface{}{
+				"domainName":          domain,
+				"resourceRecordName":  "_validation." + base + ".",
+				"resourceRecordType":  "CNAME",
+				"resourceRecordValue": "_token.acm-validations.aws.",
+			})
+		}
+		outputs["domainValidationOptions"] = resource.NewPropertyValue(options)
+	case "aws:route53/zone:Zone":
+		outputs["zoneId"] = resource.NewStringProperty("ZCREATED")
+		outputs["nameServers"] = resource.NewPropertyValue([]interface{}{"ns-1.awsdns-01.org", "ns-2.awsdns-02.com"})
+	case "aws:route53/record:Record":
+		outputs["fqdn"] = args.Inputs["name"]
+	case "aws:ec2/vpc:Vpc":
+		if args.Inputs["assignGeneratedIpv6CidrBlock"].IsBool() && args.Inputs["assignGeneratedIpv6CidrBlock"].BoolValue() {
+			outputs["ipv6CidrBlock"] = resource.NewStringProperty("2600:1f18:abcd:ef00::/56")
+		}
+	case "aws:ec2/vpcEndpoint:VpcEndpoint":
+		outputs["prefixListId"] = resource.NewStringProperty("pl-" + args.Name)
+	case "aws:ssm/document:Document", "aws:rds/optionGroup:OptionGroup", "aws:rds/parameterGroup:ParameterGroup":
+		outputs["name"] = resource.NewStringProperty(args.Name)
+	case "aws:ec2/instance:Instance":
+		outputs["primaryNetworkInterfaceId"] = resource.NewStringProperty(args.Name + "_eni")
+	}
+	return args.Name + "_id", outputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "aws:index/getAvailabilityZones:getAvailabilityZones":
+		zones := m.zones
+		if zones == nil {
+			zones = []string{"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1d"}
+		}
+		var names, zoneIds []interface{}
+		for i, zone := range zones {
+			names = append(names, zone)
+			zoneIds = append(zoneIds, fmt.Sprintf("use1-az%d", i+1))
+		}
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"names":   names,
+			"zoneIds": zoneIds,
+		}), nil
+	case "aws:rds/getEngineVersion:getEngineVersion":
+		family := m.engineFamily
+		if family == "" {
+			family = infra.ParameterGroupFamily(args.Args["engine"].StringValue(), args.Args["version"].StringValue())
+		}
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"engine":               args.Args["engine"].StringValue(),
+			"version":              args.Args["version"].StringValue(),
+			"parameterGroupFamily": family,
+		}), nil
+	case "aws:acm/getCertificate:getCertificate":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"arn":    "arn:aws:acm:us-east-1:123456789012:certificate/test",
+			"domain": args.Args["domain"].StringValue(),
+		}), nil
+	case "aws:route53/getZone:getZone":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"id":     "Z0123456789",
+			"zoneId": "Z0123456789",
+			"name":   args.Args["name"].StringValue(),
+		}), nil
+	case "aws:ec2/getAmi:getAmi":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"id": "ami-0nat",
+		}), nil
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"accountId": "123456789012",
+		}), nil
+	}
+	return args.Args, nil
+}
+
+// provider returns the provider reference of the recorded resource.
+func (m *mocks) provider(typeToken, name string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.resources {
+		if r.TypeToken == typeToken && r.Name == name {
+			return r.Provider
+		}
+	}
+	return ""
+}
+
+// byType returns the inputs of every recorded resource of the given type,
+// keyed by logical name.
+func (m *mocks) byType(typeToken string) map[string]map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := map[string]map[string]interface{}{}
+	for _, r := range m.resources {
+		if r.TypeToken == typeToken {
+			found[r.Name] = r.Inputs.Mappable()
+		}
+	}
+	return found
+}
+
+// policyResources returns every recorded resource as the policy pack sees
+// it, with the default tags of its provider.
+func (m *mocks) policyResources() []baseline.Resource {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defaultTags := map[string]map[string]string{}
+	for _, r := range m.resources {
+		if r.TypeToken != "pulumi:providers:aws" {
+			continue
+		}
+		tags := map[string]string{}
+		if defaults, ok := r.Inputs.Mappable()["defaultTags"].(map[string]interface{}); ok {
+			values, _ := defaults["tags"].(map[string]interface{})
+			for key, value := range values {
+				tags[key], _ = value.(string)
+			}
+		}
+		defaultTags[r.Name] = tags
+	}
+
+	var resources []baseline.Resource
+	for _, r := range m.resources {
+		// Provider references are <urn>::<id>, and the URN ends with the name
+		parts := strings.Split(r.Provider, "::")
+		var provider string
+		if len(parts) > 1 {
+			provider = parts[len(parts)-2]
+		}
+		resources = append(resources, baseline.Resource{
+			Type:        r.TypeToken,
+			Name:        r.Name,
+			Properties:  r.Inputs.Mappable(),
+			DefaultTags: defaultTags[provider],
+		})
+	}
+	return resources
+}
+
+// withConfig sets the stack configuration of a mocked run.
+func withConfig(config map[string]string) pulumi.RunOption {
+	return func(info *pulumi.RunInfo) {
+		info.Config = config
+	}
+}
+
+// configWith returns testConfig changed by overrides. An empty override
+// value removes the key.
+func configWith(overrides map[string]string) map[string]string {
+	config := map[string]string{}
+	for key, value := range testConfig {
+		config[key] = value
+	}
+	for key, value := range overrides {
+		if value == "" {
+			delete(config, key)
+		} else {
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// runStack runs the program against mocks and returns the recorded resources
+// together with the resolved stack exports.
+func runStack(t *testing.T) (*mocks, map[string]interface{}) {
+	t.Helper()
+	return runStackWith(t, nil)
+}
+
+// runStackWith runs the program like runStack with testConfig changed by
+// overrides.
+func runStackWith(t *testing.T, overrides map[string]string) (*mocks, map[string]interface{}) {
+	t.Helper()
+	return runStackConfig(t, "test", configWith(overrides))
+}
+
+// stackConfig reads the configuration of a stack file, such as
+// Pulumi.dev.yaml, encoding objects and lists as JSON like the engine does.
+func stackConfig(t *testing.T, stack string) map[string]string {
+	t.Helper()
+	content, err := os.ReadFile("Pulumi." + stack + ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Config map[string]interface{} `yaml:"config"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		t.Fatalf("reading the %s stack: %v", stack, err)
+	}
+	config := map[string]string{}
+	for key, value := range file.Config {
+		if s, ok := value.(string); ok {
+			config[key] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("encoding %s: %v", key, err)
+		}
+		config[key] = string(encoded)
+	}
+	return config
+}
+
+// runStackConfig runs the program like runStack as the stack with the
+// config.
+func runStackConfig(t *testing.T, stack string, config map[string]string) (*mocks, map[string]interface{}) {
+	t.Helper()
+	m := &mocks{}
+	var exportsMu sync.Mutex
+	exports := map[string]interface{}{}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		stack, err := newStack(ctx)
+		if err != nil {
+			return err
+		}
+		for name, value := range stack.exports() {
+			name := name
+			pulumi.ToOutput(value).ApplyT(func(v interface{}) interface{} {
+				exportsMu.Lock()
+				exports[name] = v
+				exportsMu.Unlock()
+				return v
+			})
+		}
+		return nil
+	}, pulumi.WithMocks("iac-pulumi", stack, m), withConfig(config))
+	if err != nil {
+		t.Fatalf("running the stack: %v", err)
+	}
+	return m, exports
+}
+
+// ingressPorts returns the sorted from-ports of a security group's inline
+// ingress rules.
+func ingressPorts(group map[string]interface{}) []int {
+	var ports []int
+	rules, _ := group["ingress"].([]interface{})
+	for _, rule := range rules {
+		ports = append(ports, int(rule.(map[string]interface{})["fromPort"].(float64)))
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+func TestSubnetCidrs(t *testing.T) {
+	m, _ := runStack(t)
+	subnets := m.byType("aws:ec2/subnet:Subnet")
+
+	want := map[string]string{
+		testName("public-subnet-1"):  "10.0.0.0/24",
+		testName("public-subnet-2"):  "10.0.1.0/24",
+		testName("public-subnet-3"):  "10.0.2.0/24",
+		testName("private-subnet-1"): "10.0.3.0/24",
+		testName("private-subnet-2"): "10.0.4.0/24",
+		testName("private-subnet-3"): "10.0.5.0/24",
+	}
+	if len(subnets) != len(want) {
+		t.Fatalf("got %d subnets, want %d", len(subnets), len(want))
+	}
+	for name, cidr := range want {
+		subnet, ok := subnets[name]
+		if !ok {
+			t.Errorf("subnet %s was not created", name)
+			continue
+		}
+		if subnet["cidrBlock"] != cidr {
+			t.Errorf("subnet %s has CIDR %v, want %s", name, subnet["cidrBlock"], cidr)
+		}
+	}
+	if subnets[testName("public-subnet-1")]["mapPublicIpOnLaunch"] != true {
+		t.Errorf("public subnets should map public IPs on launch")
+	}
+	if subnets[testName("private-subnet-1")]["mapPublicIpOnLaunch"] == true {
+		t.Errorf("private subnets should not map public IPs on launch")
+	}
+}
+
+func TestAvailabilityZoneCount(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		zones     []string
+		overrides map[string]string
+		// subnets is the number of subnets of each tier, zero when the
+		// program fails.
+		subnets int
+	}{
+		{"default in a large region", nil, nil, 3},
+		{"default in a small region", []string{"us-west-1a", "us-west-1c"}, nil, 2},
+		{"default in a single zone", []string{"us-west-1a"}, nil, 0},
+		{"set", []string{"us-west-1a", "us-west-1c"}, map[string]string{"iac-pulumi:availabilityZoneCount": "2"}, 2},
+		{"set above the zones", []string{"us-west-1a", "us-west-1c"}, map[string]string{"iac-pulumi:availabilityZoneCount": "3"}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &mocks{zones: test.zones}
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				_, err := newStack(ctx)
+				return err
+			}, pulumi.WithMocks("iac-pulumi", "test", m), withConfig(configWith(test.overrides)))
+			if test.subnets == 0 {
+				if err == nil || !strings.Contains(err.Error(), "availability zones") {
+					t.Errorf("running the stack = %v, want an availability zone error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("running the stack: %v", err)
+			}
+			var public int
+			for name := range m.byType("aws:ec2/subnet:Subnet") {
+				if strings.HasPrefix(name, testName("public-subnet-")) {
+					public++
+				}
+			}
+			if public != test.subnets {
+				t.Errorf("got %d public subnets, want %d", public, test.subnets)
+			}
+		})
+	}
+}
+
+func TestSubnetTiers(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:availabilityZoneCount": "2",
+		"iac-pulumi:subnetTiers": `[
+			{"name": "public", "prefixLength": 24, "public": true},
+			{"name": "private-app", "prefixLength": 22},
+			{"name": "private-db", "prefixLength": 26}
+		]`,
+		"database:subnetTier": "private-db",
+	})
+	subnets := m.byType("aws:ec2/subnet:Subnet")
+
+	want := map[string]string{
+		testName("public-subnet-1"):      "10.0.0.0/24",
+		testName("public-subnet-2"):      "10.0.1.0/24",
+		testName("private-app-subnet-1"): "10.0.4.0/22",
+		testName("private-app-subnet-2"): "10.0.8.0/22",
+		testName("private-db-subnet-1"):  "10.0.2.0/26",
+		testName("private-db-subnet-2"):  "10.0.2.64/26",
+	}
+	if len(subnets) != len(want) {
+		t.Fatalf("got %d subnets, want %d", len(subnets), len(want))
+	}
+	for name, cidr := range want {
+		if subnets[name]["cidrBlock"] != cidr {
+			t.Errorf("subnet %s has CIDR %v, want %s", name, subnets[name]["cidrBlock"], cidr)
+		}
+	}
+
+	group := m.byType("aws:rds/subnetGroup:SubnetGroup")[testName("database-subnet-group")]
+	ids, _ := group["subnetIds"].([]interface{})
+	if len(ids) != 2 || ids[0] != testName("private-db-subnet-1")+"_id" {
+		t.Errorf("database subnet group uses %v, want the private-db subnets", ids)
+	}
+
+	associations := m.byType("aws:ec2/routeTableAssociation:RouteTableAssociation")
+	if len(associations) != len(want) {
+		t.Errorf("got %d route table associations, want one per subnet", len(associations))
+	}
+}
+
+func TestDualStack(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:availabilityZoneCount": "2",
+		"iac-pulumi:dualStack":             "true",
+		"application:aliases":              `["www.dev.example.com"]`,
+	})
+	subnets := m.byType("aws:ec2/subnet:Subnet")
+	for name, block := range map[string]string{
+		testName("public-subnet-1"):  "2600:1f18:abcd:ef00::/64",
+		testName("public-subnet-2"):  "2600:1f18:abcd:ef01::/64",
+		testName("private-subnet-1"): "2600:1f18:abcd:ef02::/64",
+		testName("private-subnet-2"): "2600:1f18:abcd:ef03::/64",
+	} {
+		if subnets[name]["ipv6CidrBlock"] != block || subnets[name]["assignIpv6AddressOnCreation"] != true {
+			t.Errorf("subnet %s has IPv6 block %v, want %s", name, subnets[name]["ipv6CidrBlock"], block)
+		}
+	}
+
+	routes := m.byType("aws:ec2/route:Route")
+	if route := routes[testName("public-ipv6-route")]; route["destinationIpv6CidrBlock"] != "::/0" || route["gatewayId"] != testName("internet-gateway")+"_id" {
+		t.Errorf("public IPv6 route = %v, want ::/0 through the internet gateway", route)
+	}
+	if route := routes[testName("private-ipv6-route-1")]; route["egressOnlyGatewayId"] != testName("egress-only-gateway")+"_id" {
+		t.Errorf("private IPv6 route = %v, want the egress-only gateway", route)
+	}
+	for _, loadBalancer := range m.byType("aws:lb/loadBalancer:LoadBalancer") {
+		if loadBalancer["ipAddressType"] != "dualstack" {
+			t.Errorf("load balancer IP address type = %v, want dualstack", loadBalancer["ipAddressType"])
+		}
+	}
+	records := m.byType("aws:route53/record:Record")
+	for name, domain := range map[string]string{
+		testName("application-ipv6-record"): "dev.example.com",
+		testName("alias-ipv6-record-1"):     "www.dev.example.com",
+	} {
+		record := records[name]
+		aliases, _ := record["aliases"].([]interface{})
+		if record["type"] != "AAAA" || record["name"] != domain || len(aliases) != 1 {
+			t.Errorf("record %s = %v, want an AAAA alias of the load balancer for %s", name, record, domain)
+		}
+	}
+
+	m, _ = runStack(t)
+	for name, record := range m.byType("aws:route53/record:Record") {
+		if record["type"] == "AAAA" {
+			t.Errorf("record %s is AAAA without dual-stack", name)
+		}
+	}
+}
+
+func TestNatModes(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		m, _ := runStack(t)
+		if gateways := m.byType("aws:ec2/natGateway:NatGateway"); len(gateways) != 0 {
+			t.Errorf("got %d NAT gateways, want none by default", len(gateways))
+		}
+		if routes := m.byType("aws:ec2/route:Route"); len(routes) != 1 {
+			t.Errorf("got %d routes, want only the public one", len(routes))
+		}
+	})
+
+	t.Run("single", func(t *testing.T) {
+		m, _ := runStackWith(t, map[string]string{"iac-pulumi:natMode": "single"})
+		gateways := m.byType("aws:ec2/natGateway:NatGateway")
+		gateway, ok := gateways[testName("nat-gateway-1")]
+		if len(gateways) != 1 || !ok {
+			t.Fatalf("got NAT gateways %v, want one", gateways)
+		}
+		if gateway["subnetId"] != testName("public-subnet-1")+"_id" {
+			t.Errorf("NAT gateway is in %v, want the first public subnet", gateway["subnetId"])
+		}
+		route := m.byType("aws:ec2/route:Route")[testName("private-nat-route-1")]
+		if route["natGatewayId"] != testName("nat-gateway-1")+"_id" || route["routeTableId"] != testName("private-route-table")+"_id" {
+			t.Errorf("private route = %v, want the shared table routed to the NAT gateway", route)
+		}
+	})
+
+	t.Run("per-az", func(t *testing.T) {
+		m, _ := runStackWith(t, map[string]string{"iac-pulumi:natMode": "per-az"})
+		if eips := m.byType("aws:ec2/eip:Eip"); len(eips) != 3 {
+			t.Errorf("got %d Elastic IPs, want one per zone", len(eips))
+		}
+		if tables := m.byType("aws:ec2/routeTable:RouteTable"); len(tables) != 4 {
+			t.Errorf("got %d route tables, want a public one and one private one per zone", len(tables))
+		}
+		routes := m.byType("aws:ec2/route:Route")
+		associations := m.byType("aws:ec2/routeTableAssociation:RouteTableAssociation")
+		for zone := 1; zone <= 3; zone++ {
+			index := fmt.Sprint(zone)
+			gateway := m.byType("aws:ec2/natGateway:NatGateway")[testName("nat-gateway-"+index)]
+			if gateway["subnetId"] != testName("public-subnet-"+index)+"_id" {
+				t.Errorf("NAT gateway %d is in %v", zone, gateway["subnetId"])
+			}
+			table := testName("private-zone-route-table-"+index) + "_id"
+			if route := routes[testName("private-nat-route-"+index)]; route["routeTableId"] != table || route["natGatewayId"] != testName("nat-gateway-"+index)+"_id" {
+				t.Errorf("private route %d = %v, want its zone's table and NAT gateway", zone, route)
+			}
+			if association := associations[testName("private-rta-"+index)]; association["routeTableId"] != table {
+				t.Errorf("private subnet %d is associated to %v, want %s", zone, association["routeTableId"], table)
+			}
+		}
+	})
+
+	t.Run("instance", func(t *testing.T) {
+		m, _ := runStackWith(t, map[string]string{"iac-pulumi:natMode": "instance"})
+		if gateways := m.byType("aws:ec2/natGateway:NatGateway"); len(gateways) != 0 {
+			t.Errorf("got %d NAT gateways, want none in instance mode", len(gateways))
+		}
+		instance := m.byType("aws:ec2/instance:Instance")[testName("nat-instance")]
+		if instance["sourceDestCheck"] != false || instance["ami"] != "ami-0nat" || instance["instanceType"] != "t3.nano" {
+			t.Errorf("NAT instance = %v, want a t3.nano from the looked up AMI without source/dest check", instance)
+		}
+		route := m.byType("aws:ec2/route:Route")[testName("private-nat-route-1")]
+		if route["networkInterfaceId"] != testName("nat-instance")+"_eni" {
+			t.Errorf("private route = %v, want the NAT instance's network interface", route)
+		}
+	})
+}
+
+func TestSecurityGroupRules(t *testing.T) {
+	m, _ := runStack(t)
+	groups := m.byType("aws:ec2/securityGroup:SecurityGroup")
+
+	if got := ingressPorts(groups[testName("load-balancer-security-group")]); !slices.Equal(got, []int{80, 443}) {
+		t.Errorf("load balancer ingress ports = %v, want [80 443]", got)
+	}
+	if got := ingressPorts(groups[testName("application-security-group")]); !slices.Equal(got, []int{22, 8080}) {
+		t.Errorf("application ingress ports = %v, want [22 8080]", got)
+	}
+	if got := ingressPorts(groups[testName("database-security-group")]); !slices.Equal(got, []int{3306}) {
+		t.Errorf("database ingress ports = %v, want [3306]", got)
+	}
+
+	// The application only accepts traffic from the load balancer.
+	for _, rule := range groups[testName("application-security-group")]["ingress"].([]interface{}) {
+		rule := rule.(map[string]interface{})
+		if _, open := rule["cidrBlocks"]; open {
+			t.Errorf("application ingress on port %v is open to a CIDR block", rule["fromPort"])
+		}
+	}
+
+	rules := m.byType("aws:ec2/securityGroupRule:SecurityGroupRule")
+	egress, ok := rules[testName("application-database-egress")]
+	if !ok {
+		t.Fatalf("application database egress rule was not created")
+	}
+	if egress["fromPort"] != float64(3306) || egress["type"] != "egress" {
+		t.Errorf("application database egress = %v, want egress on 3306", egress)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:listeners": `[
+			{"port": 443, "protocol": "HTTPS", "additionalCertificates": ["www.example.com"]},
+			{"port": 8443, "protocol": "HTTPS", "certificate": "arn:aws:acm:us-east-1:123456789012:certificate/admin", "sslPolicy": "ELBSecurityPolicy-FS-1-2-Res-2020-10"},
+			{"port": 80, "protocol": "HTTP", "action": "fixed-response"}
+		]`,
+		"iac-pulumi:ports":     "[8080]",
+		"iac-pulumi:sslPolicy": "ELBSecurityPolicy-TLS13-1-2-2021-06",
+	})
+	groups := m.byType("aws:ec2/securityGroup:SecurityGroup")
+	if got := ingressPorts(groups[testName("load-balancer-security-group")]); !slices.Equal(got, []int{80, 443, 8443}) {
+		t.Errorf("load balancer ingress ports = %v, want one per listener", got)
+	}
+
+	listeners := m.byType("aws:alb/listener:Listener")
+	if len(listeners) != 3 {
+		t.Fatalf("got %d listeners, want 3", len(listeners))
+	}
+	https := listeners[testName("listener")]
+	if https["certificateArn"] != "arn:aws:acm:us-east-1:123456789012:certificate/test" || https["port"] != float64(443) {
+		t.Errorf("HTTPS listener = %v, want the application certificate on 443", https)
+	}
+	if https["sslPolicy"] != "ELBSecurityPolicy-TLS13-1-2-2021-06" {
+		t.Errorf("HTTPS listener TLS policy = %v, want the stack policy", https["sslPolicy"])
+	}
+	admin := listeners[testName("listener-8443")]
+	if admin["certificateArn"] != "arn:aws:acm:us-east-1:123456789012:certificate/admin" || admin["sslPolicy"] != "ELBSecurityPolicy-FS-1-2-Res-2020-10" {
+		t.Errorf("listener on 8443 = %v, want its own certificate and TLS policy", admin)
+	}
+	certificates := m.byType("aws:alb/listenerCertificate:ListenerCertificate")
+	sni := certificates[testName("listener-443-certificate-1")]
+	if len(certificates) != 1 || sni["listenerArn"] == nil || sni["certificateArn"] != "arn:aws:acm:us-east-1:123456789012:certificate/test" {
+		t.Errorf("listener certificates = %v, want the www certificate on the 443 listener", certificates)
+	}
+	http := listeners[testName("listener-80")]
+	actions, _ := http["defaultActions"].([]interface{})
+	if _, ok := http["certificateArn"]; ok || len(actions) != 1 || actions[0].(map[string]interface{})["type"] != "fixed-response" {
+		t.Errorf("HTTP listener = %v, want a fixed response without a certificate", http)
+	}
+}
+
+func TestIssuedCertificate(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:certificateMode": "issue",
+		"iac-pulumi:certificateSans": `["*.dev.example.com", "www.example.com"]`,
+	})
+	certificate := m.byType("aws:acm/certificate:Certificate")[testName("certificate")]
+	sans, _ := certificate["subjectAlternativeNames"].([]interface{})
+	if certificate["domainName"] != "dev.example.com" || certificate["validationMethod"] != "DNS" || len(sans) != 2 {
+		t.Errorf("certificate = %v, want dev.example.com and its SANs validated through DNS", certificate)
+	}
+
+	// The wildcard shares the record of dev.example.com.
+	records := m.byType("aws:route53/record:Record")
+	for name, want := range map[string]string{
+		testName("certificate-validation-record-1"): "_validation.dev.example.com.",
+		testName("certificate-validation-record-2"): "_validation.www.example.com.",
+	} {
+		if records[name]["name"] != want || records[name]["zoneId"] != "Z0123456789" {
+			t.Errorf("validation record %s = %v, want %s in the hosted zone", name, records[name], want)
+		}
+	}
+	if _, ok := records[testName("certificate-validation-record-3")]; ok {
+		t.Errorf("a validation record was created twice for the wildcard")
+	}
+	validation := m.byType("aws:acm/certificateValidation:CertificateValidation")[testName("certificate-validation")]
+	if fqdns, _ := validation["validationRecordFqdns"].([]interface{}); len(fqdns) != 2 {
+		t.Errorf("certificate validation waits on %v, want both records", fqdns)
+	}
+
+	https := m.byType("aws:alb/listener:Listener")[testName("listener")]
+	if https["certificateArn"] != "arn:aws:acm:us-east-1:123456789012:certificate/issued" {
+		t.Errorf("HTTPS listener serves %v, want the issued certificate", https["certificateArn"])
+	}
+}
+
+func TestHostedZone(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:hostedZoneMode":    "create",
+		"iac-pulumi:parentZoneId":      "ZPARENT",
+		"iac-pulumi:parentZoneRoleArn": "arn:aws:iam::210987654321:role/dns-delegation",
+	})
+	zone := m.byType("aws:route53/zone:Zone")[testName("hosted-zone")]
+	if zone["name"] != "dev.example.com" {
+		t.Errorf("hosted zone = %v, want dev.example.com", zone)
+	}
+
+	records := m.byType("aws:route53/record:Record")
+	delegation := records[testName("zone-delegation")]
+	servers, _ := delegation["records"].([]interface{})
+	if delegation["zoneId"] != "ZPARENT" || delegation["type"] != "NS" || len(servers) != 2 {
+		t.Errorf("delegation = %v, want the name servers in the parent zone", delegation)
+	}
+	if provider := m.provider("aws:route53/record:Record", testName("zone-delegation")); !strings.Contains(provider, "parent-zone") {
+		t.Errorf("delegation is managed by %q, want the parent zone provider", provider)
+	}
+	if provider := m.byType("pulumi:providers:aws")["parent-zone"]; provider["assumeRole"] == nil {
+		t.Errorf("parent zone provider = %v, want it to assume the delegation role", provider)
+	}
+	if record := records[testName("application-record")]; record["zoneId"] != "ZCREATED" {
+		t.Errorf("application record is in zone %v, want the created zone", record["zoneId"])
+	}
+}
+
+func TestAliases(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"aws:profile":                "",
+		"application:hostname":       "{env}.{domain}",
+		"application:aliases":        `["www.{env}.{domain}"]`,
+		"iac-pulumi:certificateMode": "issue",
+	})
+	records := m.byType("aws:route53/record:Record")
+	if record := records[testName("application-record")]; record["name"] != "test.example.com" {
+		t.Errorf("application record = %v, want test.example.com", record["name"])
+	}
+	if record := records[testName("alias-record-1")]; record["name"] != "www.test.example.com" || record["type"] != "A" {
+		t.Errorf("alias record = %v, want an A record for www.test.example.com", record)
+	}
+	certificate := m.byType("aws:acm/certificate:Certificate")[testName("certificate")]
+	if sans, _ := certificate["subjectAlternativeNames"].([]interface{}); !slices.Contains(sans, interface{}("www.test.example.com")) {
+		t.Errorf("certificate SANs = %v, want the alias", sans)
+	}
+	if provider := m.byType("pulumi:providers:aws")["aws"]; provider["profile"] != nil {
+		t.Errorf("provider profile = %v, want the default credentials", provider["profile"])
+	}
+}
+
+func TestHttpRedirect(t *testing.T) {
+	m, _ := runStack(t)
+	listeners := m.byType("aws:alb/listener:Listener")
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want HTTPS and the HTTP redirect", len(listeners))
+	}
+	actions, _ := listeners[testName("listener-80")]["defaultActions"].([]interface{})
+	if len(actions) != 1 {
+		t.Fatalf("HTTP listener has %d actions, want 1", len(actions))
+	}
+	redirect, _ := actions[0].(map[string]interface{})["redirect"].(map[string]interface{})
+	if redirect["port"] != "443" || redirect["protocol"] != "HTTPS" || redirect["statusCode"] != "HTTP_301" {
+		t.Errorf("HTTP listener redirect = %v, want a 301 to HTTPS on 443", redirect)
+	}
+
+	m, _ = runStackWith(t, map[string]string{"iac-pulumi:httpRedirect": "false"})
+	if listeners := m.byType("aws:alb/listener:Listener"); len(listeners) != 1 {
+		t.Errorf("got %d listeners, want only HTTPS without the redirect", len(listeners))
+	}
+}
+
+func TestUserData(t *testing.T) {
+	m, _ := runStack(t)
+	template, ok := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	if !ok {
+		t.Fatalf("launch template was not created")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(template["userData"].(string))
+	if err != nil {
+		t.Fatalf("user data is not base64: %v", err)
+	}
+	userData := string(decoded)
+	if !strings.HasPrefix(userData, "#cloud-config\n") {
+		t.Fatalf("user data is not a cloud-init document:\n%s", userData)
+	}
+	var document struct {
+		WriteFiles []struct {
+			Path        string `yaml:"path"`
+			Owner       string `yaml:"owner"`
+			Permissions string `yaml:"permissions"`
+			Content     string `yaml:"content"`
+		} `yaml:"write_files"`
+		Runcmd [][]string `yaml:"runcmd"`
+	}
+	if err := yaml.Unmarshal(decoded, &document); err != nil {
+		t.Fatalf("user data is not YAML: %v", err)
+	}
+	if len(document.WriteFiles) != 2 {
+		t.Fatalf("user data writes %d files, want the agent configuration and the environment file", len(document.WriteFiles))
+	}
+	logsConfig := document.WriteFiles[0]
+	for _, value := range []string{`"log_group_name":"` + testName("application-log-group") + `"`, `"file_path":"/var/log/webapp/assessment-application.log"`} {
+		if !strings.Contains(logsConfig.Content, value) {
+			t.Errorf("agent configuration %s does not contain %s:\n%s", logsConfig.Path, value, logsConfig.Content)
+		}
+	}
+	if _, ok := m.byType("aws:cloudwatch/logGroup:LogGroup")[testName("application-log-group")]; !ok {
+		t.Errorf("application log group was not created")
+	}
+	envFile := document.WriteFiles[1]
+	if envFile.Path != "/opt/app/.env" || envFile.Owner != "webapp:csye6225" || envFile.Permissions != "0640" {
+		t.Errorf("environment file = %s %s %s, want /opt/app/.env webapp:csye6225 0640", envFile.Path, envFile.Owner, envFile.Permissions)
+	}
+	for _, line := range []string{
+		"DB_HOST=" + testDatabaseAddress,
+		"DB_PORT=3306",
+		"DB_USER=csye6225",
+		"DB_NAME=cloud",
+		"PORT=8080",
+		"FILE_PATH=/opt/users.csv",
+		"LOG_FILE_PATH=/var/log/webapp/assessment-application.log",
+		"AWS_REGION=us-east-1",
+	} {
+		if !slices.Contains(strings.Split(envFile.Content, "\n"), line) {
+			t.Errorf("environment file does not contain %q:\n%s", line, envFile.Content)
+		}
+	}
+
+	var commands []string
+	for _, command := range document.Runcmd {
+		commands = append(commands, strings.Join(command, " "))
+	}
+	for _, command := range []string{
+		"--secret-id arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("database-secret"),
+		"chown webapp:csye6225 /opt/app/assessment-application",
+		"-a fetch-config -m ec2 -c file:/opt/aws/amazon-cloudwatch-agent/etc/amazon-cloudwatch-agent.json",
+		"-a append-config -m ec2 -c file:/opt/aws/amazon-cloudwatch-agent/etc/application-logs.json -s",
+	} {
+		if !strings.Contains(strings.Join(commands, "\n"), command) {
+			t.Errorf("user data does not run %q:\n%s", command, userData)
+		}
+	}
+	if strings.Contains(userData, "generated-password") {
+		t.Errorf("user data contains the database password:\n%s", userData)
+	}
+}
+
+func TestUserDataHasNoPlaceholders(t *testing.T) {
+	m, _ := runStack(t)
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	decoded, err := base64.StdEncoding.DecodeString(template["userData"].(string))
+	if err != nil {
+		t.Fatalf("user data is not base64: %v", err)
+	}
+	userData := string(decoded)
+	if placeholders := regexp.MustCompile(`\$\{[^}]*\}`).FindAllString(userData, -1); len(placeholders) > 0 {
+		t.Errorf("user data still contains %v:\n%s", placeholders, userData)
+	}
+	if !strings.Contains(userData, "SUBMISSION_TOPIC_ARN="+testTopicArn+"\n") {
+		t.Errorf("user data does not contain the topic ARN:\n%s", userData)
+	}
+}
+
+// TestUserDataWaitsForOutputs renders user data with a topic ARN that is only
+// resolved after the rendering has started, so the rendered document must
+// wait for it.
+func TestUserDataWaitsForOutputs(t *testing.T) {
+	var checked bool
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		arn, resolveArn, _ := ctx.NewOutput()
+		userData := &infra.CloudConfig{
+			EnvFiles: []infra.EnvFile{{
+				Path: "/opt/app/.env",
+				Vars: []infra.EnvVar{
+					{Name: "DB_HOST", Value: pulumi.String(testDatabaseAddress)},
+					{Name: "SUBMISSION_TOPIC_ARN", Value: arn.ApplyT(func(v interface{}) string {
+						return v.(string)
+					}).(pulumi.StringOutput)},
+				},
+			}},
+		}
+		rendered := userData.Render()
+		resolveArn(testTopicArn)
+		rendered.ApplyT(func(userData string) string {
+			checked = true
+			if !strings.Contains(userData, "SUBMISSION_TOPIC_ARN="+testTopicArn+"\n") {
+				t.Errorf("user data does not contain the topic ARN resolved after rendering started:\n%s", userData)
+			}
+			return userData
+		})
+		return nil
+	}, pulumi.WithMocks("iac-pulumi", "test", &mocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checked {
+		t.Errorf("the user data was never rendered")
+	}
+}
+
+func TestPipelineSecrets(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{"smtp:key": "mailgun-key-value"})
+	function := m.byType("aws:lambda/function:Function")[testName("submission-lambda")]
+	environment, _ := function["environment"].(map[string]interface{})
+	variables, _ := environment["variables"].(map[string]interface{})
+	for variable, secret := range map[string]string{
+		"MAILGUN_SMTP_KEY_SECRET_ARN":   "smtp-key-secret",
+		"GOOGLE_CREDENTIALS_SECRET_ARN": "gcp-key-secret",
+	} {
+		if want := "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName(secret); variables[variable] != want {
+			t.Errorf("%s = %v, want %s", variable, variables[variable], want)
+		}
+	}
+	for variable, value := range variables {
+		if strings.Contains(fmt.Sprint(value), "mailgun-key-value") {
+			t.Errorf("%s contains the SMTP key", variable)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.resources {
+		if r.TypeToken == "aws:secretsmanager/secretVersion:SecretVersion" && !r.Inputs["secretString"].IsSecret() {
+			t.Errorf("secret string of %s is not marked secret", r.Name)
+		}
+	}
+}
+
+func TestDatabasePassword(t *testing.T) {
+	for _, test := range []struct {
+		mode      string
+		overrides map[string]string
+		password  string
+		secretArn string
+	}{
+		{infra.PasswordGenerate, nil, "generated-password", "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("database-secret")},
+		{infra.PasswordConfig, map[string]string{"database:masterPassword": "test-password"}, "test-password", "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("database-secret")},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			m, exports := runStackWith(t, test.overrides)
+			instance := m.byType("aws:rds/instance:Instance")[testName("database")]
+			if got := fmt.Sprint(instance["password"]); !strings.Contains(got, test.password) {
+				t.Errorf("database password = %s, want %s", got, test.password)
+			}
+			version := m.byType("aws:secretsmanager/secretVersion:SecretVersion")[testName("database-secret-version")]
+			if got := fmt.Sprint(version["secretString"]); !strings.Contains(got, `"password":"`+test.password+`"`) || !strings.Contains(got, `"username":"csye6225"`) {
+				t.Errorf("secret string = %s, want the master credentials", got)
+			}
+			if _, generated := m.byType("random:index/randomPassword:RandomPassword")[testName("database-password")]; generated != (test.mode == infra.PasswordGenerate) {
+				t.Errorf("password generated = %v, want %v", generated, test.mode == infra.PasswordGenerate)
+			}
+			policy := m.byType("aws:iam/rolePolicy:RolePolicy")[testName("database-secret-policy")]
+			if got := fmt.Sprint(policy["policy"]); !strings.Contains(got, test.secretArn) || !strings.Contains(got, "secretsmanager:GetSecretValue") {
+				t.Errorf("secret policy = %s, want GetSecretValue on %s", got, test.secretArn)
+			}
+			if exports["Database Secret ARN"] != test.secretArn {
+				t.Errorf("Database Secret ARN = %v, want %s", exports["Database Secret ARN"], test.secretArn)
+			}
+		})
+	}
+}
+
+func TestDatabaseParameters(t *testing.T) {
+	m, _ := runStack(t)
+	if _, ok := m.byType("aws:rds/optionGroup:OptionGroup")[testName("database-option-group")]; ok {
+		t.Errorf("the option group was created without options")
+	}
+
+	m, _ = runStackWith(t, map[string]string{
+		"database:parameters": `{"slow_query_log": {"value": "1"}, "max_connections": {"value": "200", "applyMethod": "pending-reboot"}}`,
+		"database:options":    `[{"name": "MARIADB_AUDIT_PLUGIN", "settings": {"SERVER_AUDIT_EVENTS": "CONNECT,QUERY"}}]`,
+	})
+	group := m.byType("aws:rds/parameterGroup:ParameterGroup")[testName("database-parameter-group")]
+	want := []interface{}{
+		map[string]interface{}{"name": "max_connections", "value": "200", "applyMethod": "pending-reboot"},
+		map[string]interface{}{"name": "slow_query_log", "value": "1", "applyMethod": "immediate"},
+	}
+	if !reflect.DeepEqual(group["parameters"], want) {
+		t.Errorf("parameters = %v, want %v", group["parameters"], want)
+	}
+
+	optionGroup, ok := m.byType("aws:rds/optionGroup:OptionGroup")[testName("database-option-group")]
+	if !ok {
+		t.Fatalf("the option group was not created")
+	}
+	if optionGroup["engineName"] != "mariadb" || optionGroup["majorEngineVersion"] != "10.11" {
+		t.Errorf("option group = %v, want one for mariadb 10.11", optionGroup)
+	}
+	options := optionGroup["options"].([]interface{})
+	if len(options) != 1 || options[0].(map[string]interface{})["optionName"] != "MARIADB_AUDIT_PLUGIN" {
+		t.Errorf("options = %v, want the audit plugin", options)
+	}
+	instance := m.byType("aws:rds/instance:Instance")[testName("database")]
+	if instance["optionGroupName"] != testName("database-option-group") {
+		t.Errorf("database option group = %v, want %s", instance["optionGroupName"], testName("database-option-group"))
+	}
+}
+
+func TestParameterGroupFamily(t *testing.T) {
+	m := &mocks{engineFamily: "mariadb10.6"}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err := newStack(ctx)
+		return err
+	}, pulumi.WithMocks("iac-pulumi", "test", m), withConfig(configWith(nil)))
+	if err == nil || !strings.Contains(err.Error(), "the parameter group family of mariadb 10.11.5 is mariadb10.6, not mariadb10.11") {
+		t.Errorf("running the stack = %v, want the family RDS reports to be checked", err)
+	}
+}
+
+func TestDatabasePort(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{"database:port": "3307"})
+	instance := m.byType("aws:rds/instance:Instance")[testName("database")]
+	if instance["port"] != float64(3307) {
+		t.Errorf("database port = %v, want the configured 3307", instance["port"])
+	}
+
+	// The application connects to the port of the database
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	userData, err := base64.StdEncoding.DecodeString(template["userData"].(string))
+	if err != nil {
+		t.Fatalf("user data is not base64: %v", err)
+	}
+	if !strings.Contains(string(userData), "DB_PORT=3307\n") {
+		t.Errorf("user data does not connect to port 3307:\n%s", userData)
+	}
+
+	m, _ = runStackWith(t, map[string]string{
+		"database:port":          "3307",
+		"database:engine":        "aurora-mysql",
+		"database:engineVersion": "8.0.mysql_aurora.3.04.0",
+		"database:family":        "aurora-mysql8.0",
+		"database:storageSize":   "",
+	})
+	cluster := m.byType("aws:rds/cluster:Cluster")[testName("database-cluster")]
+	if cluster["port"] != float64(3307) {
+		t.Errorf("Aurora cluster port = %v, want the configured 3307", cluster["port"])
+	}
+}
+
+func TestAuroraCluster(t *testing.T) {
+	aurora := map[string]string{
+		"database:engine":             "aurora-mysql",
+		"database:engineVersion":      "8.0.mysql_aurora.3.04.0",
+		"database:family":             "aurora-mysql8.0",
+		"database:instanceClass":      "db.r6g.large",
+		"database:storageSize":        "",
+		"database:readers":            "2",
+		"database:parameters":         `{"slow_query_log": {"value": "1"}}`,
+		"database:instanceParameters": `{"performance_schema": {"value": "1", "applyMethod": "pending-reboot"}}`,
+	}
+	m, exports := runStackWith(t, aurora)
+	if _, ok := m.byType("aws:rds/instance:Instance")[testName("database")]; ok {
+		t.Errorf("the database instance was created with an Aurora engine")
+	}
+	cluster, ok := m.byType("aws:rds/cluster:Cluster")[testName("database-cluster")]
+	if !ok {
+		t.Fatalf("the Aurora cluster was not created")
+	}
+	if cluster["engine"] != "aurora-mysql" || cluster["databaseName"] != "cloud" || cluster["masterUsername"] != "csye6225" {
+		t.Errorf("Aurora cluster = %v, want the engine, database and user of the config", cluster)
+	}
+	if cluster["dbSubnetGroupName"] == nil || len(cluster["vpcSecurityGroupIds"].([]interface{})) != 1 {
+		t.Errorf("Aurora cluster = %v, want the subnet group and security group of the database", cluster)
+	}
+	parameterGroup := m.byType("aws:rds/clusterParameterGroup:ClusterParameterGroup")[testName("database-cluster-parameter-group")]
+	if parameterGroup["family"] != "aurora-mysql8.0" || len(parameterGroup["parameters"].([]interface{})) != 1 {
+		t.Errorf("cluster parameter group = %v, want the parameters of the config", parameterGroup)
+	}
+	instanceParameterGroup := m.byType("aws:rds/parameterGroup:ParameterGroup")[testName("database-parameter-group")]
+	wantParameters := []interface{}{
+		map[string]interface{}{"name": "performance_schema", "value": "1", "applyMethod": "pending-reboot"},
+	}
+	if instanceParameterGroup["family"] != "aurora-mysql8.0" || !reflect.DeepEqual(instanceParameterGroup["parameters"], wantParameters) {
+		t.Errorf("instance parameter group = %v, want the instance parameters of the config", instanceParameterGroup)
+	}
+
+	instances := m.byType("aws:rds/clusterInstance:ClusterInstance")
+	if len(instances) != 3 {
+		t.Fatalf("got %d cluster instances, want a writer and 2 readers", len(instances))
+	}
+	for _, name := range []string{testName("aurora-instance-1"), testName("aurora-instance-2"), testName("aurora-instance-3")} {
+		instance := instances[name]
+		if instance["instanceClass"] != "db.r6g.large" || instance["publiclyAccessible"] != false {
+			t.Errorf("cluster instance %s = %v, want a private db.r6g.large", name, instance)
+		}
+		if instance["dbParameterGroupName"] != testName("database-parameter-group") {
+			t.Errorf("cluster instance %s parameter group = %v, want the instance parameter group", name, instance["dbParameterGroupName"])
+		}
+	}
+
+	if got, want := exports["Database Endpoint"], testClusterAddress+":3306"; got != want {
+		t.Errorf("Database Endpoint = %v, want %s", got, want)
+	}
+	if got, want := exports["Database Reader Endpoint"], "reader."+testClusterAddress; got != want {
+		t.Errorf("Database Reader Endpoint = %v, want %s", got, want)
+	}
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	userData, err := base64.StdEncoding.DecodeString(template["userData"].(string))
+	if err != nil {
+		t.Fatalf("user data is not base64: %v", err)
+	}
+	if !strings.Contains(string(userData), "DB_HOST="+testClusterAddress+"\n") {
+		t.Errorf("user data does not connect to the writer of the cluster:\n%s", userData)
+	}
+
+	aurora["database:serverless"] = `{"minCapacity": 0.5, "maxCapacity": 8}`
+	aurora["database:instanceClass"] = ""
+	aurora["database:readers"] = ""
+	m, _ = runStackWith(t, aurora)
+	cluster = m.byType("aws:rds/cluster:Cluster")[testName("database-cluster")]
+	scaling := cluster["serverlessv2ScalingConfiguration"].(map[string]interface{})
+	if scaling["minCapacity"] != 0.5 || scaling["maxCapacity"] != float64(8) {
+		t.Errorf("serverless scaling = %v, want 0.5-8", scaling)
+	}
+	instances = m.byType("aws:rds/clusterInstance:ClusterInstance")
+	if len(instances) != 1 || instances[testName("aurora-instance-1")]["instanceClass"] != "db.serverless" {
+		t.Errorf("cluster instances = %v, want a db.serverless writer", instances)
+	}
+}
+
+func TestDatabaseProfiles(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{"database:storageEncrypted": ""})
+	instance := m.byType("aws:rds/instance:Instance")[testName("database")]
+	if instance["multiAz"] != false || instance["skipFinalSnapshot"] != true || instance["storageEncrypted"] != false {
+		t.Errorf("dev database = %v, want the settings it always had", instance)
+	}
+	if _, ok := m.byType("aws:iam/role:Role")[testName("database-monitoring-role")]; ok {
+		t.Errorf("the monitoring role was created with the dev profile")
+	}
+
+	m, _ = runStackWith(t, map[string]string{
+		"database:profile":      "prod",
+		"database:kmsKeyId":     "arn:aws:kms:us-east-1:123456789012:key/test",
+		"database:backupWindow": "03:00-04:00",
+	})
+	instance = m.byType("aws:rds/instance:Instance")[testName("database")]
+	for key, want := range map[string]interface{}{
+		"storageEncrypted":           true,
+		"kmsKeyId":                   "arn:aws:kms:us-east-1:123456789012:key/test",
+		"multiAz":                    true,
+		"deletionProtection":         true,
+		"backupRetentionPeriod":      float64(7),
+		"backupWindow":               "03:00-04:00",
+		"skipFinalSnapshot":          false,
+		"finalSnapshotIdentifier":    testName("database-final-snapshot"),
+		"performanceInsightsEnabled": true,
+		"monitoringInterval":         float64(60),
+	} {
+		if instance[key] != want {
+			t.Errorf("prod database %s = %v, want %v", key, instance[key], want)
+		}
+	}
+	role, ok := m.byType("aws:iam/role:Role")[testName("database-monitoring-role")]
+	if !ok {
+		t.Fatalf("the monitoring role was not created")
+	}
+	if !strings.Contains(role["assumeRolePolicy"].(string), "monitoring.rds.amazonaws.com") {
+		t.Errorf("monitoring role cannot be assumed by RDS:\n%s", role["assumeRolePolicy"])
+	}
+	policy := m.byType("aws:iam/rolePolicy:RolePolicy")[testName("database-monitoring-policy")]
+	if resource := "arn:aws:logs:us-east-1:123456789012:log-group:RDSOSMetrics:*"; !strings.Contains(policy["policy"].(string), `"`+resource+`"`) {
+		t.Errorf("monitoring policy does not grant %s:\n%s", resource, policy["policy"])
+	}
+}
+
+func TestRootVolume(t *testing.T) {
+	m, _ := runStack(t)
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	mappings, _ := template["blockDeviceMappings"].([]interface{})
+	if len(mappings) != 1 {
+		t.Fatalf("got %d block device mappings, want 1", len(mappings))
+	}
+	ebs := mappings[0].(map[string]interface{})["ebs"].(map[string]interface{})
+	if ebs["volumeSize"] != float64(25) || ebs["volumeType"] != "gp2" {
+		t.Errorf("root volume = %v, want 25 GiB gp2", ebs)
+	}
+}
+
+func TestPrivateInstances(t *testing.T) {
+	t.Run("public", func(t *testing.T) {
+		m, _ := runStack(t)
+		group := m.byType("aws:autoscaling/group:Group")[testName("auto-scaling-group")]
+		subnets, _ := group["vpcZoneIdentifiers"].([]interface{})
+		if len(subnets) != 3 || subnets[0] != testName("public-subnet-1")+"_id" {
+			t.Errorf("instances run in %v, want the public subnets", subnets)
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		m, _ := runStackWith(t, map[string]string{
+			"iac-pulumi:instanceSubnetTier": "private",
+			"iac-pulumi:natMode":            "single",
+		})
+		group := m.byType("aws:autoscaling/group:Group")[testName("auto-scaling-group")]
+		subnets, _ := group["vpcZoneIdentifiers"].([]interface{})
+		if len(subnets) != 3 || subnets[0] != testName("private-subnet-1")+"_id" {
+			t.Errorf("instances run in %v, want the private subnets", subnets)
+		}
+		// The load balancer name is shortened to fit its limit.
+		for _, loadBalancer := range m.byType("aws:lb/loadBalancer:LoadBalancer") {
+			if lbSubnets, _ := loadBalancer["subnets"].([]interface{}); len(lbSubnets) != 3 || lbSubnets[0] != testName("public-subnet-1")+"_id" {
+				t.Errorf("load balancer is in %v, want the public subnets", lbSubnets)
+			}
+		}
+
+		template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+		if _, ok := template["vpcSecurityGroupIds"]; ok {
+			t.Errorf("launch template sets vpcSecurityGroupIds next to a network interface")
+		}
+		interfaces, _ := template["networkInterfaces"].([]interface{})
+		if len(interfaces) != 1 {
+			t.Fatalf("got %d network interfaces, want 1", len(interfaces))
+		}
+		networkInterface := interfaces[0].(map[string]interface{})
+		groups, _ := networkInterface["securityGroups"].([]interface{})
+		if networkInterface["associatePublicIpAddress"] != "false" || len(groups) != 1 || groups[0] != testName("application-security-group")+"_id" {
+			t.Errorf("network interface = %v, want the application security group and no public IP", networkInterface)
+		}
+	})
+}
+
+func TestVpcEndpoints(t *testing.T) {
+	m, _ := runStackWith(t, map[string]string{
+		"iac-pulumi:instanceSubnetTier": "private",
+		"iac-pulumi:vpcEndpoints":       `["dynamodb", "logs", "monitoring", "secretsmanager", "sns"]`,
+	})
+	vpc := m.byType("aws:ec2/vpc:Vpc")[testName("vpc")]
+	if vpc["enableDnsSupport"] != true || vpc["enableDnsHostnames"] != true {
+		t.Errorf("VPC = %v, want DNS support and hostnames for the private DNS of the endpoints", vpc)
+	}
+	endpoints := m.byType("aws:ec2/vpcEndpoint:VpcEndpoint")
+	if len(endpoints) != 5 {
+		t.Fatalf("got %d VPC endpoints, want 5", len(endpoints))
+	}
+
+	dynamodb := endpoints[testName("dynamodb-endpoint")]
+	if dynamodb["serviceName"] != "com.amazonaws.us-east-1.dynamodb" || dynamodb["vpcEndpointType"] != "Gateway" {
+		t.Errorf("dynamodb endpoint = %v, want a gateway endpoint", dynamodb)
+	}
+	if tables, _ := dynamodb["routeTableIds"].([]interface{}); len(tables) != 2 {
+		t.Errorf("dynamodb endpoint is in route tables %v, want the public and private ones", tables)
+	}
+	logs := endpoints[testName("logs-endpoint")]
+	subnets, _ := logs["subnetIds"].([]interface{})
+	groups, _ := logs["securityGroupIds"].([]interface{})
+	if logs["vpcEndpointType"] != "Interface" || len(subnets) != 3 || subnets[0] != testName("private-subnet-1")+"_id" ||
+		len(groups) != 1 || groups[0] != testName("vpc-endpoint-security-group")+"_id" {
+		t.Errorf("logs endpoint = %v, want an interface endpoint in the instance subnets", logs)
+	}
+
+	rules := m.byType("aws:ec2/securityGroupRule:SecurityGroupRule")
+	if _, ok := rules[testName("application-cloudwatch-egress")]; ok {
+		t.Errorf("application egress is still open to the internet")
+	}
+	if rule := rules[testName("application-endpoint-egress")]; rule["sourceSecurityGroupId"] != testName("vpc-endpoint-security-group")+"_id" {
+		t.Errorf("application endpoint egress = %v, want the endpoint security group", rule)
+	}
+	rule := rules[testName("application-dynamodb-egress")]
+	if prefixLists, _ := rule["prefixListIds"].([]interface{}); len(prefixLists) != 1 || prefixLists[0] != "pl-"+testName("dynamodb-endpoint") {
+		t.Errorf("application dynamodb egress = %v, want the endpoint prefix list", rule)
+	}
+}
+
+func TestIamPolicies(t *testing.T) {
+	m, _ := runStack(t)
+	if attachments := m.byType("aws:iam/rolePolicyAttachment:RolePolicyAttachment"); len(attachments) > 0 {
+		t.Errorf("got managed policy attachments %v, want inline policies only", attachments)
+	}
+
+	logGroup := "arn:aws:logs:us-east-1:123456789012:log-group:"
+	policies := m.byType("aws:iam/rolePolicy:RolePolicy")
+	for _, test := range []struct {
+		policy    string
+		role      string
+		resources []string
+	}{
+		{"cloudwatch-agent-policy", "cloudwatch-agent-role", []string{logGroup + testName("application-log-group") + ":*", "*"}},
+		{"sns-policy", "cloudwatch-agent-role", []string{testTopicArn}},
+		{"database-secret-policy", "cloudwatch-agent-role", []string{"arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("database-secret")}},
+		{"dynamodb-policy", "lambda-role", []string{testTableArn}},
+		{"lambda-secrets-policy", "lambda-role", []string{
+			"arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("smtp-key-secret"),
+			"arn:aws:secretsmanager:us-east-1:123456789012:secret:" + testName("gcp-key-secret"),
+		}},
+		{"lambda-logs-policy", "lambda-role", []string{logGroup + "/aws/lambda/" + testName("submission-lambda") + ":*"}},
+	} {
+		policy, ok := policies[testName(test.policy)]
+		if !ok {
+			t.Errorf("%s was not created", test.policy)
+			continue
+		}
+		if policy["role"] != testName(test.role) {
+			t.Errorf("%s is on role %v, want %s", test.policy, policy["role"], testName(test.role))
+		}
+		var document struct {
+			Statement []struct {
+				Effect   string
+				Action   []string
+				Resource []string
+			}
+		}
+		if err := json.Unmarshal([]byte(policy["policy"].(string)), &document); err != nil {
+			t.Fatalf("%s is not a policy document: %v", test.policy, err)
+		}
+		var resources []string
+		for _, statement := range document.Statement {
+			for _, action := range statement.Action {
+				if strings.HasSuffix(action, ":*") {
+					t.Errorf("%s allows %s, want specific actions", test.policy, action)
+				}
+			}
+			resources = append(resources, statement.Resource...)
+		}
+		if !slices.Equal(resources, test.resources) {
+			t.Errorf("%s applies to %v, want %v", test.policy, resources, test.resources)
+		}
+	}
+}
+
+func TestAccessModes(t *testing.T) {
+	m, _ := runStack(t)
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	if template["keyName"] != "test-key" {
+		t.Errorf("launch template key = %v, want test-key with SSH access", template["keyName"])
+	}
+	if _, ok := m.byType("aws:iam/rolePolicy:RolePolicy")[testName("session-manager-policy")]; ok {
+		t.Errorf("the session manager policy was created with SSH access")
+	}
+
+	m, exports := runStackWith(t, map[string]string{
+		"iac-pulumi:sshKeyName":     "",
+		"iac-pulumi:sessionLogging": `{"cloudWatch": true, "retentionDays": 30, "s3Bucket": "audit-bucket", "s3KeyPrefix": "sessions/"}`,
+	})
+	template = m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	if _, ok := template["keyName"]; ok {
+		t.Errorf("launch template key = %v, want none with Session Manager", template["keyName"])
+	}
+	groups := m.byType("aws:ec2/securityGroup:SecurityGroup")
+	if got := ingressPorts(groups[testName("application-security-group")]); !slices.Equal(got, []int{8080}) {
+		t.Errorf("application ingress ports = %v, want port 22 left out", got)
+	}
+
+	policy, ok := m.byType("aws:iam/rolePolicy:RolePolicy")[testName("session-manager-policy")]
+	if !ok {
+		t.Fatalf("the session manager policy was not created")
+	}
+	if policy["role"] != testName("cloudwatch-agent-role") {
+		t.Errorf("session manager policy is on role %v, want the instance role", policy["role"])
+	}
+	for _, resource := range []string{
+		"arn:aws:ec2:us-east-1:123456789012:instance/*",
+		"arn:aws:logs:us-east-1:123456789012:log-group:" + testName("session-log-group") + ":*",
+		"arn:aws:s3:::audit-bucket/sessions/*",
+	} {
+		if !strings.Contains(policy["policy"].(string), `"`+resource+`"`) {
+			t.Errorf("session manager policy does not grant %s:\n%s", resource, policy["policy"])
+		}
+	}
+
+	logGroup := m.byType("aws:cloudwatch/logGroup:LogGroup")[testName("session-log-group")]
+	if logGroup["retentionInDays"] != float64(30) {
+		t.Errorf("session log group = %v, want a retention of 30 days", logGroup)
+	}
+	document, ok := m.byType("aws:ssm/document:Document")[testName("session-preferences")]
+	if !ok {
+		t.Fatalf("the session preferences document was not created")
+	}
+	var content struct {
+		SessionType string
+		Inputs      map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(document["content"].(string)), &content); err != nil {
+		t.Fatalf("session preferences are not JSON: %v", err)
+	}
+	if content.Inputs["cloudWatchLogGroupName"] != testName("session-log-group") || content.Inputs["s3BucketName"] != "audit-bucket" {
+		t.Errorf("session preferences = %v, want the log group and the bucket", content.Inputs)
+	}
+	if exports["Session Document"] != testName("session-preferences") {
+		t.Errorf("Session Document = %v, want the session preferences", exports["Session Document"])
+	}
+}
+
+func TestDefaultTags(t *testing.T) {
+	m, exports := runStack(t)
+
+	provider, ok := m.byType("pulumi:providers:aws")["aws"]
+	if !ok {
+		t.Fatalf("the AWS provider was not created")
+	}
+	tags := provider["defaultTags"].(map[string]interface{})["tags"].(map[string]interface{})
+	for key, value := range map[string]string{
+		"Project":    "iac-pulumi",
+		"Stack":      "test",
+		"Owner":      "platform-team",
+		"CostCenter": "CSYE6225",
+	} {
+		if tags[key] != value {
+			t.Errorf("default tag %s = %v, want %s", key, tags[key], value)
+		}
+	}
+	// A new commit must not update every resource
+	if _, ok := tags["GitCommit"]; ok {
+		t.Errorf("default tags = %v, want no GitCommit tag", tags)
+	}
+	if exports["Git Commit"] != "abc1234" {
+		t.Errorf("Git Commit = %v, want abc1234", exports["Git Commit"])
+	}
+
+	bucket := m.byType("gcp:storage/bucket:Bucket")[testName("bucket")]
+	labels, _ := bucket["labels"].(map[string]interface{})
+	if _, ok := labels["git-commit"]; labels["cost-center"] != "csye6225" || ok {
+		t.Errorf("bucket labels = %v, want cost-center and no git-commit label", labels)
+	}
+
+	account := m.byType("gcp:serviceAccount/account:Account")[testName("service-account")]
+	if description, _ := account["description"].(string); !strings.Contains(description, "owner=platform-team") {
+		t.Errorf("service account description = %q, want the owner label", description)
+	}
+
+	group := m.byType("aws:autoscaling/group:Group")[testName("auto-scaling-group")]
+	propagated := map[string]bool{}
+	for _, tag := range group["tags"].([]interface{}) {
+		tag := tag.(map[string]interface{})
+		if tag["propagateAtLaunch"] == true {
+			propagated[tag["key"].(string)] = true
+		}
+	}
+	for _, key := range []string{"Name", "Project", "Owner", "CostCenter"} {
+		if !propagated[key] {
+			t.Errorf("auto scaling group does not propagate the %s tag", key)
+		}
+	}
+}
+
+func TestInstanceRefresh(t *testing.T) {
+	m, _ := runStack(t)
+	group := m.byType("aws:autoscaling/group:Group")[testName("auto-scaling-group")]
+	launchTemplate, _ := group["launchTemplate"].(map[string]interface{})
+	if launchTemplate["version"] != "2" {
+		t.Errorf("launch template version = %v, want the latest version 2 so that a new one refreshes the instances", launchTemplate["version"])
+	}
+	refresh, _ := group["instanceRefresh"].(map[string]interface{})
+	if refresh["strategy"] != "Rolling" {
+		t.Errorf("instance refresh = %v, want a rolling refresh", refresh)
+	}
+
+	// A new password changes the user data, and so the launch template
+	template := m.byType("aws:ec2/launchTemplate:LaunchTemplate")[testName("launch-template")]
+	userData, err := base64.StdEncoding.DecodeString(template["userData"].(string))
+	if err != nil {
+		t.Fatalf("user data is not base64: %v", err)
+	}
+	if want := "DB_PASSWORD_VERSION=version-" + testName("database-secret-version") + "\n"; !strings.Contains(string(userData), want) {
+		t.Errorf("user data does not contain %q:\n%s", want, userData)
+	}
+}
+
+func TestExports(t *testing.T) {
+	_, exports := runStack(t)
+	if got, want := exports["Database Endpoint"], testDatabaseAddress+":3306"; got != want {
+		t.Errorf("Database Endpoint = %v, want %s", got, want)
+	}
+}
+
+func TestPolicyBaseline(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		// want are the mandatory policies the stack violates.
+		want []string
+	}{
+		{"defaults", nil, nil},
+		{"unencrypted database", map[string]string{"database:storageEncrypted": ""}, []string{"rds-storage-encrypted"}},
+		{"issued certificate", map[string]string{"iac-pulumi:certificateMode": "issue"}, nil},
+		{"plain http", map[string]string{
+			"iac-pulumi:listeners": `[{"port": 80, "protocol": "HTTP", "action": "forward"}]`,
+		}, []string{"https-only-listeners"}},
+		{"no owner", map[string]string{"iac-pulumi:owner": ""}, []string{"required-tags"}},
+		{"SNI certificates", map[string]string{
+			"iac-pulumi:listeners": `[{"port": 443, "protocol": "HTTPS", "additionalCertificates": ["www.example.com"]}]`,
+		}, nil},
+		{"session manager", map[string]string{
+			"iac-pulumi:sshKeyName":     "",
+			"iac-pulumi:sessionLogging": `{"cloudWatch": true, "s3Bucket": "audit-bucket"}`,
+		}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m, _ := runStackWith(t, test.overrides)
+			checkPolicyBaseline(t, m, test.want)
+		})
+	}
+}
+
+// TestPolicyBaselineDevStack runs the dev stack as it is committed, with only
+// the secrets that are set outside of the file.
+func TestPolicyBaselineDevStack(t *testing.T) {
+	config := stackConfig(t, "dev")
+	for key, value := range map[string]string{"smtp:username": "postmaster@example.com", "smtp:key": "test-smtp-key"} {
+		if _, ok := config[key]; ok {
+			t.Fatalf("%s is committed to the dev stack", key)
+		}
+		config[key] = value
+	}
+	m, _ := runStackConfig(t, "dev", config)
+	checkPolicyBaseline(t, m, nil)
+}
+
+// awsArgs are the arguments of every AWS resource type the program creates,
+// by type token.
+var awsArgs = map[string]interface{}{
+	"aws:acm/certificate:Certificate":                             acm.CertificateArgs{},
+	"aws:acm/certificateValidation:CertificateValidation":         acm.CertificateValidationArgs{},
+	"aws:alb/listener:Listener":                                   alb.ListenerArgs{},
+	"aws:alb/listenerCertificate:ListenerCertificate":             alb.ListenerCertificateArgs{},
+	"aws:lb/loadBalancer:LoadBalancer":                            lb.LoadBalancerArgs{},
+	"aws:alb/targetGroup:TargetGroup":                             alb.TargetGroupArgs{},
+	"aws:autoscaling/group:Group":                                 autoscaling.GroupArgs{},
+	"aws:autoscaling/policy:Policy":                               autoscaling.PolicyArgs{},
+	"aws:cloudwatch/logGroup:LogGroup":                            cloudwatch.LogGroupArgs{},
+	"aws:cloudwatch/metricAlarm:MetricAlarm":                      cloudwatch.MetricAlarmArgs{},
+	"aws:dynamodb/table:Table":                                    dynamodb.TableArgs{},
+	"aws:ec2/egressOnlyInternetGateway:EgressOnlyInternetGateway": ec2.EgressOnlyInternetGatewayArgs{},
+	"aws:ec2/eip:Eip":                                             ec2.EipArgs{},
+	"aws:ec2/instance:Instance":                                   ec2.InstanceArgs{},
+	"aws:ec2/internetGateway:InternetGateway":                     ec2.InternetGatewayArgs{},
+	"aws:ec2/launchTemplate:LaunchTemplate":                       ec2.LaunchTemplateArgs{},
+	"aws:ec2/natGateway:NatGateway":                               ec2.NatGatewayArgs{},
+	"aws:ec2/route:Route":                                         ec2.RouteArgs{},
+	"aws:ec2/routeTable:RouteTable":                               ec2.RouteTableArgs{},
+	"aws:ec2/routeTableAssociation:RouteTableAssociation":         ec2.RouteTableAssociationArgs{},
+	"aws:ec2/securityGroup:SecurityGroup":                         ec2.SecurityGroupArgs{},
+	"aws:ec2/securityGroupRule:SecurityGroupRule":                 ec2.SecurityGroupRuleArgs{},
+	"aws:ec2/subnet:Subnet":                                       ec2.SubnetArgs{},
+	"aws:ec2/vpc:Vpc":                                             ec2.VpcArgs{},
+	"aws:ec2/vpcEndpoint:VpcEndpoint":                             ec2.VpcEndpointArgs{},
+	"aws:iam/instanceProfile:InstanceProfile":                     iam.InstanceProfileArgs{},
+	"aws:iam/role:Role":                                           iam.RoleArgs{},
+	"aws:iam/rolePolicy:RolePolicy":                               iam.RolePolicyArgs{},
+	"aws:lambda/function:Function":                                lambda.FunctionArgs{},
+	"aws:lambda/permission:Permission":                            lambda.PermissionArgs{},
+	"aws:rds/cluster:Cluster":                                     rds.ClusterArgs{},
+	"aws:rds/clusterInstance:ClusterInstance":                     rds.ClusterInstanceArgs{},
+	"aws:rds/clusterParameterGroup:ClusterParameterGroup":         rds.ClusterParameterGroupArgs{},
+	"aws:rds/instance:Instance":                                   rds.InstanceArgs{},
+	"aws:rds/optionGroup:OptionGroup":                             rds.OptionGroupArgs{},
+	"aws:rds/parameterGroup:ParameterGroup":                       rds.ParameterGroupArgs{},
+	"aws:rds/subnetGroup:SubnetGroup":                             rds.SubnetGroupArgs{},
+	"aws:route53/record:Record":                                   route53.RecordArgs{},
+	"aws:route53/zone:Zone":                                       route53.ZoneArgs{},
+	"aws:secretsmanager/secret:Secret":                            secretsmanager.SecretArgs{},
+	"aws:secretsmanager/secretVersion:SecretVersion":              secretsmanager.SecretVersionArgs{},
+	"aws:sns/topic:Topic":                                         sns.TopicArgs{},
+	"aws:sns/topicSubscription:TopicSubscription":                 sns.TopicSubscriptionArgs{},
+	"aws:ssm/document:Document":                                   ssm.DocumentArgs{},
+}
+
+// TestRequiredTagsTypes checks that the required-tags policy skips exactly
+// the AWS resource types of the stack whose arguments have no tags.
+func TestRequiredTagsTypes(t *testing.T) {
+	types := map[string]bool{}
+	for _, overrides := range []map[string]string{
+		nil,
+		{"iac-pulumi:certificateMode": "issue"},
+		{"iac-pulumi:dualStack": "true", "iac-pulumi:natMode": "instance"},
+		{"iac-pulumi:instanceSubnetTier": "private", "iac-pulumi:vpcEndpoints": `["dynamodb", "logs", "monitoring", "secretsmanager", "sns"]`},
+		{"iac-pulumi:listeners": `[{"port": 443, "protocol": "HTTPS", "additionalCertificates": ["www.example.com"]}]`},
+		{"iac-pulumi:sshKeyName": "", "iac-pulumi:sessionLogging": `{"cloudWatch": true, "s3Bucket": "audit-bucket"}`},
+		{
+			"database:engine":        "aurora-mysql",
+			"database:engineVersion": "8.0.mysql_aurora.3.04.0",
+			"database:family":        "aurora-mysql8.0",
+			"database:storageSize":   "",
+		},
+	} {
+		m, _ := runStackWith(t, overrides)
+		for _, r := range m.policyResources() {
+			if strings.HasPrefix(r.Type, "aws:") {
+				types[r.Type] = true
+			}
+		}
+	}
+
+	for typ := range types {
+		args, ok := awsArgs[typ]
+		if !ok {
+			t.Errorf("the stack creates %s, which is not in awsArgs", typ)
+			continue
+		}
+		_, taggable := reflect.TypeOf(args).FieldByName("Tags")
+		untagged := baseline.Check(baseline.Resource{Type: typ, Name: "untagged"})
+		var checked bool
+		for _, violation := range untagged {
+			checked = checked || violation.Policy.Name == "required-tags"
+		}
+		if checked != taggable {
+			t.Errorf("required-tags checks %s = %v, want %v from its tags argument", typ, checked, taggable)
+		}
+	}
+}
+
+// checkPolicyBaseline checks that the stack violates exactly the mandatory
+// policies it wants.
+func checkPolicyBaseline(t *testing.T, m *mocks, want []string) {
+	t.Helper()
+	var got []string
+	for _, r := range m.policyResources() {
+		for _, violation := range baseline.Check(r) {
+			if violation.Policy.EnforcementLevel != baseline.Mandatory {
+				continue
+			}
+			got = append(got, violation.Policy.Name)
+			if !slices.Contains(want, violation.Policy.Name) {
+				t.Errorf("%s %s violates %s: %s", r.Type, r.Name, violation.Policy.Name, violation.Message)
+			}
+		}
+	}
+	for _, policy := range want {
+		if !slices.Contains(got, policy) {
+			t.Errorf("the stack does not violate %s", policy)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package baseline holds the security baseline of the stack as policies over
+// the inputs of its resources. The policy pack serves them to the Pulumi
+// engine, and tests run them against mocked resources.
+package baseline
+
+import (
+	"sort"
+)
+
+// EnforcementLevel is how a violation of a policy is reported.
+type EnforcementLevel string
+
+const (
+	// Advisory violations are reported but do not stop the deployment.
+	Advisory EnforcementLevel = "advisory"
+	// Mandatory violations stop the deployment.
+	Mandatory EnforcementLevel = "mandatory"
+)
+
+// Resource is a resource of the stack, with its inputs as plain values:
+// maps, slices, strings, float64 numbers and bools.
+type Resource struct {
+	Type       string
+	Name       string
+	Properties map[string]interface{}
+	// DefaultTags are the default tags of the resource's provider.
+	DefaultTags map[string]string
+}
+
+// Policy is a rule of the baseline. Validate returns a message for every
+// problem it finds on a resource, and nothing for the resources it does not
+// apply to.
+type Policy struct {
+	Name             string
+	Description      string
+	EnforcementLevel EnforcementLevel
+	Validate         func(r Resource) []string
+}
+
+// Violation is a problem a policy found on a resource.
+type Violation struct {
+	Policy   *Policy
+	Resource string
+	Message  string
+}
+
+// Policies are the policies of the baseline.
+var Policies = []*Policy{
+	{
+		Name:             "rds-storage-encrypted",
+		Description:      "RDS instances and clusters encrypt their storage.",
+		EnforcementLevel: Mandatory,
+		Validate:         rdsStorageEncrypted,
+	},
+	{
+		Name:             "rds-not-public",
+		Description:      "RDS instances are not publicly accessible.",
+		EnforcementLevel: Mandatory,
+		Validate:         rdsNotPublic,
+	},
+	{
+		Name:             "no-public-ssh",
+		Description:      "Security groups do not open SSH to the internet.",
+		EnforcementLevel: Mandatory,
+		Validate:         noPublicSsh,
+	},
+	{
+		Name:             "required-tags",
+		Description:      "Taggable AWS resources carry the cost allocation tags.",
+		EnforcementLevel: Mandatory,
+		Validate:         requiredTags,
+	},
+	{
+		Name:             "iam-no-wildcard-resource",
+		Description:      "IAM policies grant access to named resources, not to *.",
+		EnforcementLevel: Mandatory,
+		Validate:         iamNoWildcardResource,
+	},
+	{
+		Name:             "https-only-listeners",
+		Description:      "Load balancer listeners use HTTPS or redirect to it.",
+		EnforcementLevel: Mandatory,
+		Validate:         httpsOnlyListeners,
+	},
+}
+
+// Check runs every policy against the resource.
+func Check(r Resource) []Violation {
+	var violations []Violation
+	for _, policy := range Policies {
+		for _, message := range policy.Validate(r) {
+			violations = append(violations, Violation{Policy: policy, Resource: r.Name, Message: message})
+		}
+	}
+	return violations
+}
+
+// property returns the value at the path of nested property names.
+func property(properties map[string]interface{}, path ...string) interface{} {
+	var value interface{} = properties
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// stringsOf returns the strings of a value that is a string or a list of
+// them, as IAM policies allow either.
+func stringsOf(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// objectsOf returns the objects of a value that is an object or a list of
+// them.
+func objectsOf(value interface{}) []map[string]interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}
+	case []interface{}:
+		var objects []map[string]interface{}
+		for _, item := range value {
+			if object, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, object)
+			}
+		}
+		return objects
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
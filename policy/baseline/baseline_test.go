@@ -0,0 +1,194 @@
+package baseline
+
+import (
+	"strings"
+	"testing"
+)
+
+// allTags are tags that satisfy the required-tags policy.
+var allTags = map[string]interface{}{"Project": "p", "Stack": "s", "Owner": "o", "CostCenter": "c"}
+
+// policyNamed returns the policy of the baseline with the name.
+func policyNamed(t *testing.T, name string) *Policy {
+	t.Helper()
+	for _, policy := range Policies {
+		if policy.Name == name {
+			return policy
+		}
+	}
+	t.Fatalf("no policy %s", name)
+	return nil
+}
+
+func TestPolicies(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		policy   string
+		resource Resource
+		// want is part of the expected message, empty when the resource
+		// complies.
+		want string
+	}{
+		{"encrypted instance", "rds-storage-encrypted", Resource{
+			Type:       "aws:rds/instance:Instance",
+			Properties: map[string]interface{}{"storageEncrypted": true},
+		}, ""},
+		{"unencrypted instance", "rds-storage-encrypted", Resource{
+			Type:       "aws:rds/instance:Instance",
+			Properties: map[string]interface{}{},
+		}, "not encrypted"},
+		{"unencrypted cluster", "rds-storage-encrypted", Resource{
+			Type:       "aws:rds/cluster:Cluster",
+			Properties: map[string]interface{}{"storageEncrypted": false},
+		}, "not encrypted"},
+		{"private instance", "rds-not-public", Resource{
+			Type:       "aws:rds/instance:Instance",
+			Properties: map[string]interface{}{"publiclyAccessible": false},
+		}, ""},
+		{"public instance", "rds-not-public", Resource{
+			Type:       "aws:rds/instance:Instance",
+			Properties: map[string]interface{}{"publiclyAccessible": true},
+		}, "publicly accessible"},
+		{"ssh from the load balancer", "no-public-ssh", Resource{
+			Type: "aws:ec2/securityGroup:SecurityGroup",
+			Properties: map[string]interface{}{"ingress": []interface{}{
+				map[string]interface{}{"protocol": "tcp", "fromPort": 22.0, "toPort": 22.0, "securityGroups": []interface{}{"sg-1"}},
+				map[string]interface{}{"protocol": "tcp", "fromPort": 443.0, "toPort": 443.0, "cidrBlocks": []interface{}{"0.0.0.0/0"}},
+			}},
+		}, ""},
+		{"inline ssh from the internet", "no-public-ssh", Resource{
+			Type: "aws:ec2/securityGroup:SecurityGroup",
+			Properties: map[string]interface{}{"ingress": []interface{}{
+				map[string]interface{}{"protocol": "tcp", "fromPort": 22.0, "toPort": 22.0, "cidrBlocks": []interface{}{"0.0.0.0/0"}},
+			}},
+		}, "port 22 is open to 0.0.0.0/0"},
+		{"port range over ssh", "no-public-ssh", Resource{
+			Type: "aws:ec2/securityGroup:SecurityGroup",
+			Properties: map[string]interface{}{"ingress": []interface{}{
+				map[string]interface{}{"protocol": "6", "fromPort": 0.0, "toPort": 1024.0, "ipv6CidrBlocks": []interface{}{"::/0"}},
+			}},
+		}, "port 22 is open to ::/0"},
+		{"all traffic rule", "no-public-ssh", Resource{
+			Type: "aws:ec2/securityGroupRule:SecurityGroupRule",
+			Properties: map[string]interface{}{
+				"type": "ingress", "protocol": "-1", "fromPort": 0.0, "toPort": 0.0, "cidrBlocks": []interface{}{"0.0.0.0/0"},
+			},
+		}, "port 22 is open"},
+		{"egress rule", "no-public-ssh", Resource{
+			Type: "aws:ec2/securityGroupRule:SecurityGroupRule",
+			Properties: map[string]interface{}{
+				"type": "egress", "protocol": "-1", "fromPort": 0.0, "toPort": 0.0, "cidrBlocks": []interface{}{"0.0.0.0/0"},
+			},
+		}, ""},
+		{"vpc ingress rule", "no-public-ssh", Resource{
+			Type: "aws:vpc/securityGroupIngressRule:SecurityGroupIngressRule",
+			Properties: map[string]interface{}{
+				"ipProtocol": "tcp", "fromPort": 22.0, "toPort": 22.0, "cidrIpv4": "0.0.0.0/0",
+			},
+		}, "port 22 is open"},
+		{"tags from the provider", "required-tags", Resource{
+			Type:        "aws:ec2/vpc:Vpc",
+			Properties:  map[string]interface{}{"tags": map[string]interface{}{"Name": "vpc"}},
+			DefaultTags: map[string]string{"Project": "p", "Stack": "s", "Owner": "o", "CostCenter": "c"},
+		}, ""},
+		{"missing tags", "required-tags", Resource{
+			Type:        "aws:ec2/vpc:Vpc",
+			Properties:  map[string]interface{}{"tags": map[string]interface{}{"Name": "vpc", "Owner": "o"}},
+			DefaultTags: map[string]string{"Project": "p"},
+		}, "missing tags CostCenter, Stack"},
+		{"group tags", "required-tags", Resource{
+			Type: "aws:autoscaling/group:Group",
+			Properties: map[string]interface{}{"tags": []interface{}{
+				map[string]interface{}{"key": "Project", "value": "p"},
+			}},
+			DefaultTags: map[string]string{"Stack": "s", "Owner": "o"},
+		}, "missing tags CostCenter"},
+		{"untagged resource", "required-tags", Resource{
+			Type:       "aws:ec2/routeTableAssociation:RouteTableAssociation",
+			Properties: map[string]interface{}{},
+		}, ""},
+		{"tags from the provider only", "required-tags", Resource{
+			Type:        "aws:sns/topic:Topic",
+			Properties:  map[string]interface{}{},
+			DefaultTags: map[string]string{"Project": "p", "Stack": "s", "Owner": "o", "CostCenter": "c"},
+		}, ""},
+		{"no tags at all", "required-tags", Resource{
+			Type:       "aws:sns/topic:Topic",
+			Properties: map[string]interface{}{},
+		}, "missing tags CostCenter, Owner, Project, Stack"},
+		{"scoped policy", "iam-no-wildcard-resource", Resource{
+			Type: "aws:iam/rolePolicy:RolePolicy",
+			Properties: map[string]interface{}{"policy": `{"Version":"2012-10-17","Statement":[` +
+				`{"Effect":"Allow","Action":["sns:Publish"],"Resource":["arn:aws:sns:us-east-1:123456789012:topic"]},` +
+				`{"Effect":"Allow","Action":["cloudwatch:PutMetricData","ec2:DescribeTags"],"Resource":"*"}]}`},
+		}, ""},
+		{"wildcard policy", "iam-no-wildcard-resource", Resource{
+			Type: "aws:iam/policy:Policy",
+			Properties: map[string]interface{}{"policy": `{"Version":"2012-10-17","Statement":` +
+				`{"Sid":"Everything","Effect":"Allow","Action":"s3:*","Resource":"*"}}`},
+		}, "statement Everything allows s3:* on every resource"},
+		{"wildcard deny", "iam-no-wildcard-resource", Resource{
+			Type: "aws:iam/policy:Policy",
+			Properties: map[string]interface{}{"policy": `{"Version":"2012-10-17","Statement":` +
+				`[{"Effect":"Deny","Action":"s3:*","Resource":"*"}]}`},
+		}, ""},
+		{"inline role policy", "iam-no-wildcard-resource", Resource{
+			Type: "aws:iam/role:Role",
+			Properties: map[string]interface{}{"inlinePolicies": []interface{}{map[string]interface{}{
+				"policy": `{"Statement":[{"Effect":"Allow","Action":"sns:Publish","Resource":["*"]}]}`,
+			}}},
+		}, "statement #1 allows sns:Publish"},
+		{"https listener", "https-only-listeners", Resource{
+			Type: "aws:alb/listener:Listener",
+			Properties: map[string]interface{}{"protocol": "HTTPS", "port": 443.0, "defaultActions": []interface{}{
+				map[string]interface{}{"type": "forward"},
+			}},
+		}, ""},
+		{"redirecting listener", "https-only-listeners", Resource{
+			Type: "aws:alb/listener:Listener",
+			Properties: map[string]interface{}{"protocol": "HTTP", "port": 80.0, "defaultActions": []interface{}{
+				map[string]interface{}{"type": "redirect", "redirect": map[string]interface{}{"protocol": "HTTPS"}},
+			}},
+		}, ""},
+		{"forwarding http listener", "https-only-listeners", Resource{
+			Type: "aws:lb/listener:Listener",
+			Properties: map[string]interface{}{"protocol": "HTTP", "port": 80.0, "defaultActions": []interface{}{
+				map[string]interface{}{"type": "forward"},
+			}},
+		}, "port 80 does not redirect to HTTPS"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			messages := policyNamed(t, test.policy).Validate(test.resource)
+			if test.want == "" {
+				if len(messages) > 0 {
+					t.Errorf("got %q, want no violation", messages)
+				}
+				return
+			}
+			if len(messages) != 1 || !strings.Contains(messages[0], test.want) {
+				t.Errorf("got %q, want one violation containing %q", messages, test.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	violations := Check(Resource{
+		Type: "aws:rds/instance:Instance",
+		Name: "database",
+		Properties: map[string]interface{}{
+			"publiclyAccessible": true,
+			"tags":               allTags,
+		},
+	})
+	var got []string
+	for _, violation := range violations {
+		if violation.Resource != "database" {
+			t.Errorf("violation of %s is reported on %q", violation.Policy.Name, violation.Resource)
+		}
+		got = append(got, violation.Policy.Name)
+	}
+	if strings.Join(got, ",") != "rds-storage-encrypted,rds-not-public" {
+		t.Errorf("got violations of %v, want rds-storage-encrypted and rds-not-public", got)
+	}
+}
@@ -0,0 +1,242 @@
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// rdsStorageEncrypted reports RDS instances and clusters that do not encrypt
+// their storage.
+func rdsStorageEncrypted(r Resource) []string {
+	switch r.Type {
+	case "aws:rds/instance:Instance", "aws:rds/cluster:Cluster":
+		if property(r.Properties, "storageEncrypted") != true {
+			return []string{"storage is not encrypted; set storageEncrypted"}
+		}
+	}
+	return nil
+}
+
+// rdsNotPublic reports RDS instances that can be reached from outside of the
+// VPC.
+func rdsNotPublic(r Resource) []string {
+	switch r.Type {
+	case "aws:rds/instance:Instance", "aws:rds/clusterInstance:ClusterInstance":
+		if property(r.Properties, "publiclyAccessible") == true {
+			return []string{"the instance is publicly accessible"}
+		}
+	}
+	return nil
+}
+
+// sshPort is the port noPublicSsh keeps closed to the internet.
+const sshPort = 22
+
+// internetCidrs are the sources that stand for the whole internet.
+var internetCidrs = map[string]bool{"0.0.0.0/0": true, "::/0": true}
+
+// noPublicSsh reports ingress rules that open the SSH port to the internet,
+// whether they are inline in a security group or separate resources.
+func noPublicSsh(r Resource) []string {
+	var rules []map[string]interface{}
+	protocolKey := "protocol"
+	switch r.Type {
+	case "aws:ec2/securityGroup:SecurityGroup":
+		rules = objectsOf(property(r.Properties, "ingress"))
+	case "aws:ec2/securityGroupRule:SecurityGroupRule":
+		if property(r.Properties, "type") == "ingress" {
+			rules = objectsOf(r.Properties)
+		}
+	case "aws:vpc/securityGroupIngressRule:SecurityGroupIngressRule":
+		protocolKey = "ipProtocol"
+		rules = []map[string]interface{}{{
+			"ipProtocol":     property(r.Properties, "ipProtocol"),
+			"fromPort":       property(r.Properties, "fromPort"),
+			"toPort":         property(r.Properties, "toPort"),
+			"cidrBlocks":     property(r.Properties, "cidrIpv4"),
+			"ipv6CidrBlocks": property(r.Properties, "cidrIpv6"),
+		}}
+	}
+
+	var messages []string
+	for _, rule := range rules {
+		if !coversPort(rule, protocolKey, sshPort) {
+			continue
+		}
+		sources := append(stringsOf(rule["cidrBlocks"]), stringsOf(rule["ipv6CidrBlocks"])...)
+		for _, source := range sources {
+			if internetCidrs[source] {
+				messages = append(messages, fmt.Sprintf("port %d is open to %s", sshPort, source))
+			}
+		}
+	}
+	return messages
+}
+
+// coversPort reports whether an ingress rule lets TCP traffic through to the
+// port.
+func coversPort(rule map[string]interface{}, protocolKey string, port int) bool {
+	protocol, _ := rule[protocolKey].(string)
+	switch strings.ToLower(protocol) {
+	case "-1", "all":
+		return true
+	case "tcp", "6":
+		from, fromOk := rule["fromPort"].(float64)
+		to, toOk := rule["toPort"].(float64)
+		return fromOk && toOk && int(from) <= port && port <= int(to)
+	}
+	return false
+}
+
+// RequiredTags are the tags every taggable AWS resource carries, set by the
+// default tags of the provider.
+var RequiredTags = []string{"Project", "Stack", "Owner", "CostCenter"}
+
+// untaggedTypes are the AWS resource types of the stack that cannot be
+// tagged, which requiredTags skips. Every other AWS resource is checked,
+// whether it sets tags or only gets those of its provider. The program's
+// tests check the list against the tags argument of every type it creates.
+var untaggedTypes = map[string]bool{
+	"aws:acm/certificateValidation:CertificateValidation": true,
+	"aws:alb/listenerCertificate:ListenerCertificate":     true,
+	"aws:autoscaling/policy:Policy":                       true,
+	"aws:ec2/route:Route":                                 true,
+	"aws:ec2/routeTableAssociation:RouteTableAssociation": true,
+	"aws:ec2/securityGroupRule:SecurityGroupRule":         true,
+	"aws:iam/rolePolicy:RolePolicy":                       true,
+	"aws:lambda/permission:Permission":                    true,
+	"aws:route53/record:Record":                           true,
+	"aws:secretsmanager/secretVersion:SecretVersion":      true,
+	"aws:sns/topicSubscription:TopicSubscription":         true,
+}
+
+// requiredTags reports AWS resources that miss one of the RequiredTags, from
+// their own tags or the default tags of their provider.
+func requiredTags(r Resource) []string {
+	if !strings.HasPrefix(r.Type, "aws:") || untaggedTypes[r.Type] {
+		return nil
+	}
+
+	found := map[string]bool{}
+	for key := range r.DefaultTags {
+		found[key] = true
+	}
+	for _, source := range []interface{}{r.Properties["tags"], r.Properties["tagsAll"]} {
+		switch source := source.(type) {
+		case map[string]interface{}:
+			for key := range source {
+				found[key] = true
+			}
+		case []interface{}:
+			// Auto scaling groups list their tags as key and value pairs
+			for _, tag := range objectsOf(source) {
+				if key, ok := tag["key"].(string); ok {
+					found[key] = true
+				}
+			}
+		}
+	}
+
+	missing := map[string]bool{}
+	for _, key := range RequiredTags {
+		if !found[key] {
+			missing[key] = true
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("missing tags %s", strings.Join(sortedKeys(missing), ", "))}
+}
+
+// UnscopedActions are the IAM actions that do not support resource-level
+// permissions, and so may be granted on any resource.
+var UnscopedActions = map[string]bool{
+	"cloudwatch:PutMetricData":         true,
+	"ec2:DescribeTags":                 true,
+	"ec2:DescribeVolumes":              true,
+	"ssmmessages:CreateControlChannel": true,
+	"ssmmessages:CreateDataChannel":    true,
+	"ssmmessages:OpenControlChannel":   true,
+	"ssmmessages:OpenDataChannel":      true,
+}
+
+// iamNoWildcardResource reports IAM policy statements that allow actions on
+// every resource, unless all of the actions are UnscopedActions.
+func iamNoWildcardResource(r Resource) []string {
+	var documents []interface{}
+	switch r.Type {
+	case "aws:iam/policy:Policy", "aws:iam/rolePolicy:RolePolicy",
+		"aws:iam/userPolicy:UserPolicy", "aws:iam/groupPolicy:GroupPolicy":
+		documents = append(documents, property(r.Properties, "policy"))
+	case "aws:iam/role:Role":
+		for _, inline := range objectsOf(property(r.Properties, "inlinePolicies")) {
+			documents = append(documents, inline["policy"])
+		}
+	}
+
+	var messages []string
+	for _, document := range documents {
+		text, ok := document.(string)
+		if !ok {
+			// The policy is not known yet, as in a preview
+			continue
+		}
+		var policy map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &policy); err != nil {
+			messages = append(messages, fmt.Sprintf("the policy is not valid JSON: %v", err))
+			continue
+		}
+		for i, statement := range objectsOf(policy["Statement"]) {
+			if statement["Effect"] != "Allow" || !slices.Contains(stringsOf(statement["Resource"]), "*") {
+				continue
+			}
+			scoped := map[string]bool{}
+			for _, action := range stringsOf(statement["Action"]) {
+				if !UnscopedActions[action] {
+					scoped[action] = true
+				}
+			}
+			if len(scoped) > 0 {
+				messages = append(messages, fmt.Sprintf("statement %s allows %s on every resource",
+					statementName(statement, i), strings.Join(sortedKeys(scoped), ", ")))
+			}
+		}
+	}
+	return messages
+}
+
+// statementName names a statement by its Sid, or its position without one.
+func statementName(statement map[string]interface{}, index int) string {
+	if sid, ok := statement["Sid"].(string); ok && sid != "" {
+		return sid
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// httpsOnlyListeners reports load balancer listeners that serve plain HTTP
+// instead of redirecting it to HTTPS.
+func httpsOnlyListeners(r Resource) []string {
+	switch r.Type {
+	case "aws:lb/listener:Listener", "aws:alb/listener:Listener":
+	default:
+		return nil
+	}
+	protocol, _ := property(r.Properties, "protocol").(string)
+	if !strings.EqualFold(protocol, "HTTP") {
+		return nil
+	}
+	actions := objectsOf(property(r.Properties, "defaultActions"))
+	for _, action := range actions {
+		redirect, _ := property(action, "redirect", "protocol").(string)
+		if action["type"] != "redirect" || !strings.EqualFold(redirect, "HTTPS") {
+			return []string{fmt.Sprintf("the HTTP listener on port %v does not redirect to HTTPS", property(r.Properties, "port"))}
+		}
+	}
+	if len(actions) == 0 {
+		return []string{"the HTTP listener has no redirect to HTTPS"}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Command policy is the policy pack of the stack: a Pulumi analyzer plugin
+// that checks every resource against the security baseline before it is
+// deployed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/rpcutil"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"iac-pulumi/policy/baseline"
+	"os"
+)
+
+const (
+	packName    = "iac-pulumi-baseline"
+	packVersion = "0.1.0"
+)
+
+// enforcementLevels maps the levels of the baseline to the engine's.
+var enforcementLevels = map[baseline.EnforcementLevel]pulumirpc.EnforcementLevel{
+	baseline.Advisory:  pulumirpc.EnforcementLevel_ADVISORY,
+	baseline.Mandatory: pulumirpc.EnforcementLevel_MANDATORY,
+}
+
+// analyzer serves the baseline to the engine.
+type analyzer struct {
+	pulumirpc.UnimplementedAnalyzerServer
+}
+
+// Analyze checks the inputs of a resource before it is created or updated.
+func (a *analyzer) Analyze(_ context.Context, req *pulumirpc.AnalyzeRequest) (*pulumirpc.AnalyzeResponse, error) {
+	var providerProperties *structpb.Struct
+	if req.GetProvider() != nil {
+		providerProperties = req.GetProvider().GetProperties()
+	}
+	r, err := toResource(req.GetType(), req.GetName(), req.GetProperties(), providerProperties)
+	if err != nil {
+		return nil, err
+	}
+	var diagnostics []*pulumirpc.AnalyzeDiagnostic
+	for _, violation := range baseline.Check(r) {
+		diagnostics = append(diagnostics, &pulumirpc.AnalyzeDiagnostic{
+			PolicyName:        violation.Policy.Name,
+			PolicyPackName:    packName,
+			PolicyPackVersion: packVersion,
+			Description:       violation.Policy.Description,
+			Message:           violation.Message,
+			EnforcementLevel:  enforcementLevels[violation.Policy.EnforcementLevel],
+			Urn:               req.GetUrn(),
+		})
+	}
+	return &pulumirpc.AnalyzeResponse{Diagnostics: diagnostics}, nil
+}
+
+// AnalyzeStack has nothing to add once the stack is deployed, since every
+// policy looks at one resource at a time.
+func (a *analyzer) AnalyzeStack(context.Context, *pulumirpc.AnalyzeStackRequest) (*pulumirpc.AnalyzeResponse, error) {
+	return &pulumirpc.AnalyzeResponse{}, nil
+}
+
+// GetAnalyzerInfo describes the pack and its policies.
+func (a *analyzer) GetAnalyzerInfo(context.Context, *emptypb.Empty) (*pulumirpc.AnalyzerInfo, error) {
+	info := &pulumirpc.AnalyzerInfo{
+		Name:        packName,
+		DisplayName: "iac-pulumi security baseline",
+		Version:     packVersion,
+	}
+	for _, policy := range baseline.Policies {
+		info.Policies = append(info.Policies, &pulumirpc.PolicyInfo{
+			Name:             policy.Name,
+			Description:      policy.Description,
+			EnforcementLevel: enforcementLevels[policy.EnforcementLevel],
+		})
+	}
+	return info, nil
+}
+
+func (a *analyzer) GetPluginInfo(context.Context, *emptypb.Empty) (*pulumirpc.PluginInfo, error) {
+	return &pulumirpc.PluginInfo{Version: packVersion}, nil
+}
+
+func (a *analyzer) Configure(context.Context, *pulumirpc.ConfigureAnalyzerRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+// toResource converts the properties the engine sends to a resource of the
+// baseline. Values that are not known yet are left out, and secrets are
+// checked like any other value.
+func toResource(typ string, name string, properties *structpb.Struct, providerProperties *structpb.Struct) (baseline.Resource, error) {
+	props, err := plugin.UnmarshalProperties(properties, plugin.MarshalOptions{SkipNulls: true})
+	if err != nil {
+		return baseline.Resource{}, fmt.Errorf("reading the properties of %s: %w", name, err)
+	}
+	r := baseline.Resource{Type: typ, Name: name, Properties: props.Mappable()}
+
+	providerProps, err := plugin.UnmarshalProperties(providerProperties, plugin.MarshalOptions{SkipNulls: true})
+	if err != nil {
+		return baseline.Resource{}, fmt.Errorf("reading the provider of %s: %w", name, err)
+	}
+	r.DefaultTags = defaultTags(providerProps.Mappable())
+	return r, nil
+}
+
+// defaultTags returns the default tags of an AWS provider. The provider
+// sends its inputs as strings, so defaultTags may also be JSON encoded.
+func defaultTags(provider map[string]interface{}) map[string]string {
+	value := provider["defaultTags"]
+	if text, ok := value.(string); ok {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+			return nil
+		}
+		value = decoded
+	}
+	object, _ := value.(map[string]interface{})
+	tags, _ := object["tags"].(map[string]interface{})
+	found := map[string]string{}
+	for key, value := range tags {
+		if s, ok := value.(string); ok {
+			found[key] = s
+		}
+	}
+	return found
+}
+
+// main serves the analyzer like other plugins: the engine reads the port
+// from the first line of output.
+func main() {
+	handle, err := rpcutil.ServeWithOptions(rpcutil.ServeOptions{
+		Init: func(srv *grpc.Server) error {
+			pulumirpc.RegisterAnalyzerServer(srv, &analyzer{})
+			return nil
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serving the policy pack: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d\n", handle.Port)
+	if err := <-handle.Done; err != nil {
+		fmt.Fprintf(os.Stderr, "serving the policy pack: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	properties, err := structpb.NewStruct(map[string]interface{}{
+		"ingress": []interface{}{
+			map[string]interface{}{"protocol": "tcp", "fromPort": 22, "toPort": 22, "cidrBlocks": []interface{}{"0.0.0.0/0"}},
+		},
+		"tags": map[string]interface{}{"Name": "application"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The engine sends the inputs of a provider as strings
+	provider, err := structpb.NewStruct(map[string]interface{}{
+		"defaultTags": `{"tags":{"Project":"p","Stack":"s","Owner":"o","CostCenter":"c"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := (&analyzer{}).Analyze(context.Background(), &pulumirpc.AnalyzeRequest{
+		Type:       "aws:ec2/securityGroup:SecurityGroup",
+		Name:       "application",
+		Urn:        "urn:pulumi:dev::iac-pulumi::aws:ec2/securityGroup:SecurityGroup::application",
+		Properties: properties,
+		Provider:   &pulumirpc.AnalyzerProviderResource{Properties: provider},
+	})
+	if err != nil {
+		t.Fatalf("analyzing: %v", err)
+	}
+	if len(response.Diagnostics) != 1 {
+		t.Fatalf("got diagnostics %v, want one", response.Diagnostics)
+	}
+	diagnostic := response.Diagnostics[0]
+	if diagnostic.PolicyName != "no-public-ssh" || diagnostic.EnforcementLevel != pulumirpc.EnforcementLevel_MANDATORY {
+		t.Errorf("got %s at level %s, want a mandatory no-public-ssh violation", diagnostic.PolicyName, diagnostic.EnforcementLevel)
+	}
+	if diagnostic.Urn == "" || diagnostic.PolicyPackName != packName {
+		t.Errorf("diagnostic %v does not name the resource and the pack", diagnostic)
+	}
+}
+
+func TestGetAnalyzerInfo(t *testing.T) {
+	info, err := (&analyzer{}).GetAnalyzerInfo(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := map[string]pulumirpc.EnforcementLevel{}
+	for _, policy := range info.Policies {
+		levels[policy.Name] = policy.EnforcementLevel
+	}
+	if levels["rds-storage-encrypted"] != pulumirpc.EnforcementLevel_MANDATORY || levels["rds-not-public"] != pulumirpc.EnforcementLevel_MANDATORY {
+		t.Errorf("got policy levels %v", levels)
+	}
+}
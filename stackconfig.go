@@ -0,0 +1,897 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+	"iac-pulumi/infra"
+	"math"
+	"net"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StackConfig is the typed configuration of the stack, read from the
+// iac-pulumi, aws, database, application and smtp namespaces.
+type StackConfig struct {
+	Project     ProjectConfig
+	Aws         AwsConfig
+	Database    DatabaseConfig
+	Application ApplicationConfig
+	Smtp        SmtpConfig
+	// Tags are the default tags of every resource.
+	Tags infra.DefaultTags
+	// GitCommit is the commit the program is deployed from. It is a stack
+	// output rather than a tag, so that a new commit does not update every
+	// resource.
+	GitCommit string
+	// Names is derived from the naming pattern and overrides of the project
+	// namespace.
+	Names infra.NameTags
+}
+
+// ProjectConfig holds the keys of the iac-pulumi namespace.
+type ProjectConfig struct {
+	VpcCidr string
+	// SubnetTiers, AvailabilityZoneCount and ReservedCidrs configure the
+	// subnet plan of the VPC. AvailabilityZoneCount is zero unless the stack
+	// sets it, and the network then uses the zones the region has.
+	SubnetTiers           []infra.SubnetTier
+	AvailabilityZoneCount int
+	ReservedCidrs         []string
+	// InstanceSubnetTier is the tier the application instances run in. They
+	// run in every public subnet when it is empty.
+	InstanceSubnetTier string
+	// DualStack gives the VPC and its subnets IPv6 blocks next to IPv4.
+	DualStack bool
+	// Nat configures the egress of the private subnets.
+	Nat infra.NatArgs
+	// VpcEndpoints are the AWS services reached through VPC endpoints
+	// instead of the internet.
+	VpcEndpoints []string
+	Ipv4Cidr     string
+	Ipv6Cidr     string
+	SshKeyName   string
+	InstanceType string
+	AmiId        string
+	Ports        []int
+	// AccessMode is how operators reach the instances. SshKeyName is only
+	// used with infra.AccessSsh, SessionLogging with infra.AccessSsm.
+	AccessMode     string
+	SessionLogging infra.SessionLogging
+	// Listeners are the ports of the load balancer and what they serve.
+	Listeners []infra.Listener
+	// SslPolicy is the TLS security policy of the HTTPS listeners that do not
+	// set their own.
+	SslPolicy string
+	// CertificateMode and CertificateSans configure how the certificate of
+	// the application domain is obtained.
+	CertificateMode string
+	CertificateSans []string
+	// HostedZoneMode is whether the hosted zone of the application domain is
+	// looked up or created. A created zone is delegated from ParentZoneId,
+	// through the ParentZoneProfile and ParentZoneRoleArn credentials when
+	// the parent zone lives in another account.
+	HostedZoneMode    string
+	ParentZoneId      string
+	ParentZoneProfile string
+	ParentZoneRoleArn string
+	// LoadBalancerPorts optionally lists the ports the load balancer opens.
+	// Every one of them must have a listener.
+	LoadBalancerPorts []int
+	// RootVolumeSize and RootVolumeType override the root volume of the AMI.
+	// A size of zero keeps the AMI default.
+	RootVolumeSize int
+	RootVolumeType string
+	// LambdaPackagePath is the zip archive deployed to the Lambda function.
+	LambdaPackagePath string
+	// NamingPattern and NameOverrides configure infra.NewNameTags.
+	NamingPattern string
+	NameOverrides map[string]string
+}
+
+// AwsConfig holds the keys of the aws namespace.
+type AwsConfig struct {
+	Profile string
+	Region  string
+}
+
+// DatabaseConfig holds the keys of the database namespace.
+type DatabaseConfig struct {
+	// SubnetTier is the private subnet tier the database is placed in.
+	SubnetTier    string
+	Family        string
+	StorageSize   int
+	Engine        string
+	EngineVersion string
+	InstanceClass string
+	Name          string
+	MasterUser    string
+	// PasswordMode is how the master password is obtained. MasterPassword
+	// is the secret of the configuration, only read in PasswordConfig mode.
+	PasswordMode   string
+	MasterPassword pulumi.StringOutput
+	Port           int
+	// Parameters are the parameters of the parameter group, by name, and
+	// Options the options of the option group. InstanceParameters are the
+	// parameters of the instances of an Aurora cluster, whose Parameters go
+	// to the cluster parameter group.
+	Parameters         map[string]infra.DatabaseParameter
+	InstanceParameters map[string]infra.DatabaseParameter
+	Options            []infra.DatabaseOption
+	// Readers and Serverless shape the Aurora cluster of Aurora engines.
+	// StorageSize is only used by the other engines.
+	Readers    int
+	Serverless *infra.ServerlessCapacity
+	// Profile is the preset of Hardening, whose options each override.
+	Profile   string
+	Hardening infra.DatabaseHardening
+}
+
+// ApplicationConfig holds the keys of the application namespace.
+type ApplicationConfig struct {
+	User                 string
+	UserGroup            string
+	Port                 int
+	ResourceFile         string
+	PropertyFile         string
+	LogFile              string
+	CloudwatchConfigFile string
+	BinaryFile           string
+	DomainName           string
+	// Hostname is the domain the application is served at, expanded from the
+	// hostname template. Aliases are other names in its hosted zone that
+	// reach the same load balancer.
+	Hostname        string
+	Aliases         []string
+	HealthCheckPath string
+	GcpProject      string
+}
+
+// SmtpConfig holds the keys of the smtp namespace.
+type SmtpConfig struct {
+	UserName string
+	// Key is read as a secret.
+	Key pulumi.StringOutput
+}
+
+// subnetTierName matches the names accepted for subnet tiers, which end up in
+// resource names and tags.
+var subnetTierName = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// hostnamePlaceholder matches the placeholders of a hostname template, such
+// as {env} or {domain}.
+var hostnamePlaceholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+// hostnamePattern matches a fully qualified, lowercase hostname.
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// rootVolumeTypes are the EBS volume types accepted for rootVolumeType.
+var rootVolumeTypes = []string{"gp2", "gp3", "io1", "io2", "st1", "sc1", "standard"}
+
+// backupWindow matches the daily hh24:mi-hh24:mi UTC range of RDS backups.
+var backupWindow = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d-([01]\d|2[0-3]):[0-5]\d$`)
+
+// ConfigError describes a single missing or invalid configuration key.
+type ConfigError struct {
+	// Key is the fully qualified key, e.g. "database:port".
+	Key     string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// ConfigErrors lists every invalid or missing configuration key.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid stack configuration:\n  - %s", strings.Join(lines, "\n  - "))
+}
+
+// has reports whether a problem was already recorded for key.
+func (e ConfigErrors) has(key string) bool {
+	for _, err := range e {
+		if err.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// configReader reads the keys of one namespace and records a problem for
+// every key that is missing or cannot be parsed instead of failing on the
+// first one.
+type configReader struct {
+	conf      *config.Config
+	namespace string
+	errs      *ConfigErrors
+}
+
+func newConfigReader(ctx *pulumi.Context, namespace string, errs *ConfigErrors) configReader {
+	return configReader{conf: config.New(ctx, namespace), namespace: namespace, errs: errs}
+}
+
+// invalid records a problem with a key of the namespace. Only the first
+// problem of each key is kept, so that a missing key is not reported again
+// as an invalid value.
+func (r configReader) invalid(key string, format string, args ...interface{}) {
+	key = r.namespace + ":" + key
+	if r.errs.has(key) {
+		return
+	}
+	*r.errs = append(*r.errs, ConfigError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// invalidEach records every error joined in err as a problem with key.
+func (r configReader) invalidEach(key string, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			*r.errs = append(*r.errs, ConfigError{Key: r.namespace + ":" + key, Message: err.Error()})
+		}
+		return
+	}
+	*r.errs = append(*r.errs, ConfigError{Key: r.namespace + ":" + key, Message: err.Error()})
+}
+
+func (r configReader) require(key string) string {
+	value := r.conf.Get(key)
+	if value == "" {
+		r.invalid(key, "is required")
+	}
+	return value
+}
+
+// requireSecret reads a key that must be set as a secret output, so that its
+// value never shows in plaintext in the state or the logs.
+func (r configReader) requireSecret(key string) pulumi.StringOutput {
+	r.require(key)
+	return r.conf.GetSecret(key)
+}
+
+func (r configReader) optional(key string, fallback string) string {
+	value := r.conf.Get(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (r configReader) requireInt(key string) int {
+	value := r.require(key)
+	if value == "" {
+		return 0
+	}
+	return r.parseInt(key, value)
+}
+
+func (r configReader) optionalInt(key string, fallback int) int {
+	value := r.conf.Get(key)
+	if value == "" {
+		return fallback
+	}
+	return r.parseInt(key, value)
+}
+
+func (r configReader) parseInt(key string, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		r.invalid(key, "%q is not an integer", value)
+	}
+	return n
+}
+
+func (r configReader) optionalBool(key string, fallback bool) bool {
+	value := r.conf.Get(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.invalid(key, "%q is not a boolean", value)
+	}
+	return b
+}
+
+func (r configReader) requireObject(key string, output interface{}) {
+	value := r.require(key)
+	if value == "" {
+		return
+	}
+	r.parseObject(key, value, output)
+}
+
+func (r configReader) optionalObject(key string, output interface{}) {
+	value := r.conf.Get(key)
+	if value == "" {
+		return
+	}
+	r.parseObject(key, value, output)
+}
+
+func (r configReader) parseObject(key string, value string, output interface{}) {
+	if err := json.Unmarshal([]byte(value), output); err != nil {
+		r.invalid(key, "%q is not valid: %v", value, err)
+	}
+}
+
+// LoadStackConfig reads the whole stack configuration and validates it. The
+// returned error lists every invalid key, so that a bad stack file is
+// reported before any resource is registered.
+func LoadStackConfig(ctx *pulumi.Context) (*StackConfig, error) {
+	var errs ConfigErrors
+	var c StackConfig
+
+	project := newConfigReader(ctx, ctx.Project(), &errs)
+	c.Project.VpcCidr = project.require("vpcCidr")
+	project.optionalObject("subnetTiers", &c.Project.SubnetTiers)
+	if len(c.Project.SubnetTiers) == 0 {
+		c.Project.SubnetTiers = infra.DefaultSubnetTiers
+	}
+	c.Project.AvailabilityZoneCount = project.optionalInt("availabilityZoneCount", 0)
+	project.optionalObject("reservedCidrs", &c.Project.ReservedCidrs)
+	c.Project.InstanceSubnetTier = project.optional("instanceSubnetTier", "")
+	c.Project.DualStack = project.optionalBool("dualStack", false)
+	c.Project.Nat.Mode = infra.NatMode(project.optional("natMode", string(infra.NatNone)))
+	c.Project.Nat.InstanceType = project.optional("natInstanceType", infra.DefaultNatInstanceType)
+	c.Project.Nat.AmiId = project.optional("natInstanceAmiId", "")
+	project.optionalObject("vpcEndpoints", &c.Project.VpcEndpoints)
+	c.Project.Ipv4Cidr = project.require("ipv4Cidr")
+	c.Project.Ipv6Cidr = project.require("ipv6Cidr")
+	// Stacks that configure a key pair keep using SSH
+	accessMode := infra.AccessSsm
+	if project.conf.Get("sshKeyName") != "" {
+		accessMode = infra.AccessSsh
+	}
+	c.Project.AccessMode = project.optional("accessMode", accessMode)
+	if c.Project.AccessMode == infra.AccessSsh {
+		c.Project.SshKeyName = project.require("sshKeyName")
+	} else if project.conf.Get("sshKeyName") != "" {
+		project.invalid("sshKeyName", "is only used with accessMode %s", infra.AccessSsh)
+	}
+	project.optionalObject("sessionLogging", &c.Project.SessionLogging)
+	c.Project.InstanceType = project.require("instanceType")
+	c.Project.AmiId = project.require("amiId")
+	project.requireObject("ports", &c.Project.Ports)
+	project.optionalObject("listeners", &c.Project.Listeners)
+	if len(c.Project.Listeners) == 0 {
+		c.Project.Listeners = infra.DefaultListeners
+	}
+	if project.optionalBool("httpRedirect", true) {
+		c.Project.Listeners = infra.WithHttpRedirect(c.Project.Listeners)
+	}
+	c.Project.SslPolicy = project.optional("sslPolicy", "")
+	c.Project.CertificateMode = project.optional("certificateMode", infra.CertificateLookup)
+	project.optionalObject("certificateSans", &c.Project.CertificateSans)
+	c.Project.HostedZoneMode = project.optional("hostedZoneMode", infra.HostedZoneLookup)
+	c.Project.ParentZoneId = project.optional("parentZoneId", "")
+	c.Project.ParentZoneProfile = project.optional("parentZoneProfile", "")
+	c.Project.ParentZoneRoleArn = project.optional("parentZoneRoleArn", "")
+	project.optionalObject("loadBalancerPorts", &c.Project.LoadBalancerPorts)
+	c.Project.RootVolumeSize = project.optionalInt("rootVolumeSize", 0)
+	c.Project.RootVolumeType = project.optional("rootVolumeType", "gp2")
+	c.Project.LambdaPackagePath = project.require("path")
+	// Stacks without a pattern keep the names they were deployed with
+	c.Project.NamingPattern = project.optional("namingPattern", "")
+	project.optionalObject("names", &c.Project.NameOverrides)
+	// The old per-resource keys still override their name, unless names
+	// or another old key gives it a different one
+	legacyKeys := infra.LegacyNameKeys()
+	keys := make([]string, 0, len(legacyKeys))
+	for key := range legacyKeys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	setBy := map[string]string{}
+	for component := range c.Project.NameOverrides {
+		setBy[component] = "names"
+	}
+	for _, key := range keys {
+		value := project.conf.Get(key)
+		if value == "" {
+			continue
+		}
+		component := legacyKeys[key]
+		if name, ok := c.Project.NameOverrides[component]; ok {
+			if name != value {
+				project.invalid(key, "%q conflicts with %q, the %s name set by %s", value, name, component, setBy[component])
+			}
+			continue
+		}
+		if c.Project.NameOverrides == nil {
+			c.Project.NameOverrides = map[string]string{}
+		}
+		c.Project.NameOverrides[component] = value
+		setBy[component] = key
+		_ = ctx.Log.Warn(fmt.Sprintf("%s:%s is deprecated, set %s under %s:names instead", ctx.Project(), key, component, ctx.Project()), nil)
+	}
+
+	aws := newConfigReader(ctx, "aws", &errs)
+	c.Aws.Profile = aws.optional("profile", "")
+	c.Aws.Region = aws.require("region")
+
+	c.Tags = infra.DefaultTags{
+		Project:    ctx.Project(),
+		Stack:      ctx.Stack(),
+		Owner:      project.optional("owner", ""),
+		CostCenter: project.optional("costCenter", ""),
+	}
+	c.GitCommit = project.optional("gitCommit", "")
+	if c.GitCommit == "" {
+		c.GitCommit = gitCommit()
+	}
+	project.optionalObject("tags", &c.Tags.Extra)
+
+	db := newConfigReader(ctx, "database", &errs)
+	c.Database.SubnetTier = db.optional("subnetTier", "private")
+	c.Database.Family = db.require("family")
+	c.Database.Engine = db.require("engine")
+	c.Database.EngineVersion = db.require("engineVersion")
+	// Aurora engines run in a cluster, whose storage grows with the data
+	// and whose Serverless v2 instances have their own class
+	if infra.DatabaseBackend(c.Database.Engine) == infra.DatabaseAurora {
+		if db.conf.Get("storageSize") != "" {
+			db.invalid("storageSize", "is only used with the %s backend", infra.DatabaseInstance)
+		}
+		c.Database.Readers = db.optionalInt("readers", 0)
+		db.optionalObject("serverless", &c.Database.Serverless)
+	} else {
+		c.Database.StorageSize = db.requireInt("storageSize")
+		for _, key := range []string{"readers", "serverless"} {
+			if db.conf.Get(key) != "" {
+				db.invalid(key, "is only used with the %s backend", infra.DatabaseAurora)
+			}
+		}
+	}
+	if c.Database.Serverless != nil {
+		c.Database.InstanceClass = db.optional("instanceClass", infra.ServerlessInstanceClass)
+	} else {
+		c.Database.InstanceClass = db.require("instanceClass")
+	}
+	c.Database.Name = db.require("name")
+	c.Database.MasterUser = db.require("masterUser")
+	// Stacks that configure a password keep using it
+	passwordMode := infra.PasswordGenerate
+	if db.conf.Get("masterPassword") != "" {
+		passwordMode = infra.PasswordConfig
+	}
+	c.Database.PasswordMode = db.optional("passwordMode", passwordMode)
+	if c.Database.PasswordMode == infra.PasswordConfig {
+		c.Database.MasterPassword = db.requireSecret("masterPassword")
+	} else if db.conf.Get("masterPassword") != "" {
+		db.invalid("masterPassword", "is only used with passwordMode %s", infra.PasswordConfig)
+	}
+	c.Database.Port = db.requireInt("port")
+	db.optionalObject("parameters", &c.Database.Parameters)
+	db.optionalObject("instanceParameters", &c.Database.InstanceParameters)
+	db.optionalObject("options", &c.Database.Options)
+	c.Database.Profile = db.optional("profile", infra.DatabaseProfileDev)
+	preset := infra.DatabaseProfiles[c.Database.Profile]
+	c.Database.Hardening = infra.DatabaseHardening{
+		StorageEncrypted:    db.optionalBool("storageEncrypted", preset.StorageEncrypted),
+		KmsKeyId:            db.optional("kmsKeyId", preset.KmsKeyId),
+		MultiAz:             db.optionalBool("multiAz", preset.MultiAz),
+		DeletionProtection:  db.optionalBool("deletionProtection", preset.DeletionProtection),
+		BackupRetentionDays: db.optionalInt("backupRetentionDays", preset.BackupRetentionDays),
+		BackupWindow:        db.optional("backupWindow", preset.BackupWindow),
+		SkipFinalSnapshot:   db.optionalBool("skipFinalSnapshot", preset.SkipFinalSnapshot),
+		PerformanceInsights: db.optionalBool("performanceInsights", preset.PerformanceInsights),
+		MonitoringInterval:  db.optionalInt("monitoringInterval", preset.MonitoringInterval),
+	}
+
+	app := newConfigReader(ctx, "application", &errs)
+	c.Application.User = app.require("user")
+	c.Application.UserGroup = app.require("userGroup")
+	c.Application.Port = app.requireInt("port")
+	c.Application.ResourceFile = app.require("resourceFile")
+	c.Application.PropertyFile = app.require("propertyFile")
+	c.Application.LogFile = app.require("logFile")
+	c.Application.CloudwatchConfigFile = app.require("cloudwatchConfigFile")
+	c.Application.BinaryFile = app.require("binaryFile")
+	c.Application.DomainName = app.require("domainName")
+	// Stacks that deploy with a named profile keep the hostname they always
+	// had, the others are named after the stack
+	hostnameTemplate := "{env}.{domain}"
+	if c.Aws.Profile != "" {
+		hostnameTemplate = "{profile}.{domain}"
+	}
+	hostnameTemplate = app.optional("hostname", hostnameTemplate)
+	var aliasTemplates []string
+	app.optionalObject("aliases", &aliasTemplates)
+	hostnameValues := map[string]string{
+		"env":     ctx.Stack(),
+		"project": ctx.Project(),
+		"domain":  c.Application.DomainName,
+		"profile": c.Aws.Profile,
+	}
+	if hostname, err := expandHostname(hostnameTemplate, hostnameValues); err != nil {
+		app.invalid("hostname", "%v", err)
+	} else {
+		c.Application.Hostname = hostname
+	}
+	for _, template := range aliasTemplates {
+		alias, err := expandHostname(template, hostnameValues)
+		if err != nil {
+			app.invalid("aliases", "%v", err)
+			continue
+		}
+		c.Application.Aliases = append(c.Application.Aliases, alias)
+	}
+	c.Application.HealthCheckPath = app.require("healthCheckPath")
+	c.Application.GcpProject = app.require("gcpProject")
+
+	smtp := newConfigReader(ctx, "smtp", &errs)
+	c.Smtp.UserName = smtp.require("username")
+	c.Smtp.Key = smtp.requireSecret("key")
+
+	c.validate(project, db, app)
+
+	names, err := infra.NewNameTags(infra.NamingArgs{
+		Pattern:   c.Project.NamingPattern,
+		Project:   ctx.Project(),
+		Stack:     ctx.Stack(),
+		Overrides: c.Project.NameOverrides,
+	})
+	if err != nil {
+		project.invalidEach("names", err)
+	}
+	c.Names = names
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &c, nil
+}
+
+// gitCommit returns the short hash of the commit the program is deployed
+// from, or an empty string outside of a git checkout.
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// subnetTier returns the subnet tier with the given name, or nil.
+func (c *StackConfig) subnetTier(name string) *infra.SubnetTier {
+	for i := range c.Project.SubnetTiers {
+		if c.Project.SubnetTiers[i].Name == name {
+			return &c.Project.SubnetTiers[i]
+		}
+	}
+	return nil
+}
+
+// validate checks the values that were read. Keys that failed to load are
+// already recorded and are skipped by configReader.invalid.
+func (c *StackConfig) validate(project, db, app configReader) {
+	p := c.Project
+	_, vpcNet, err := net.ParseCIDR(p.VpcCidr)
+	validVpcCidr := err == nil && vpcNet.IP.To4() != nil
+	if !validVpcCidr {
+		project.invalid("vpcCidr", "%q is not an IPv4 CIDR block", p.VpcCidr)
+	}
+	// The load balancer and the database subnet group both need subnets in
+	// two zones.
+	zoneCount := p.AvailabilityZoneCount
+	if project.conf.Get("availabilityZoneCount") == "" {
+		zoneCount = infra.DefaultAvailabilityZoneCount
+	} else if zoneCount < 2 {
+		project.invalid("availabilityZoneCount", "%d must be at least 2", zoneCount)
+	}
+	var hasPublicTier bool
+	for _, tier := range p.SubnetTiers {
+		if !subnetTierName.MatchString(tier.Name) {
+			project.invalid("subnetTiers", "tier name %q must be lowercase letters, digits and dashes", tier.Name)
+		}
+		hasPublicTier = hasPublicTier || tier.Public
+	}
+	if !hasPublicTier {
+		project.invalid("subnetTiers", "at least one tier must be public for the load balancer")
+	}
+	if validVpcCidr {
+		if _, err := infra.PlanSubnets(infra.SubnetPlanArgs{
+			VpcCidr:               p.VpcCidr,
+			Tiers:                 p.SubnetTiers,
+			AvailabilityZoneCount: zoneCount,
+			ReservedCidrs:         p.ReservedCidrs,
+		}); err != nil {
+			project.invalid("subnetTiers", "%v", err)
+		}
+	}
+	if !slices.Contains(infra.NatModes, p.Nat.Mode) {
+		modes := make([]string, len(infra.NatModes))
+		for i, mode := range infra.NatModes {
+			modes[i] = string(mode)
+		}
+		project.invalid("natMode", "%q must be one of %s", p.Nat.Mode, strings.Join(modes, ", "))
+	}
+	// Private instances ship their logs and publish submissions to AWS
+	// through the NAT or the VPC endpoints.
+	if p.InstanceSubnetTier != "" {
+		if tier := c.subnetTier(p.InstanceSubnetTier); tier == nil {
+			project.invalid("instanceSubnetTier", "%q is not one of the subnet tiers", p.InstanceSubnetTier)
+		} else if !tier.Public && p.Nat.Mode == infra.NatNone && len(p.VpcEndpoints) == 0 {
+			project.invalid("instanceSubnetTier", "%q is a private tier, which needs a natMode other than none or vpcEndpoints", p.InstanceSubnetTier)
+		}
+	}
+	for _, service := range p.VpcEndpoints {
+		if !slices.Contains(infra.VpcEndpointServices(), service) {
+			project.invalid("vpcEndpoints", "%q must be one of %s", service, strings.Join(infra.VpcEndpointServices(), ", "))
+		}
+	}
+	// The endpoints replace the HTTPS egress of the instances to the
+	// internet, so every service they call needs one, sessions included
+	if len(p.VpcEndpoints) > 0 {
+		for _, service := range infra.InstanceEndpoints(p.AccessMode, p.SessionLogging) {
+			if !slices.Contains(p.VpcEndpoints, service) {
+				project.invalid("vpcEndpoints", "%q is called by the instances, which reach no service without an endpoint", service)
+			}
+		}
+	}
+	if p.Nat.AmiId != "" && !strings.HasPrefix(p.Nat.AmiId, "ami-") {
+		project.invalid("natInstanceAmiId", "%q is not an AMI id", p.Nat.AmiId)
+	}
+	if c.Database.PasswordMode == "managed" {
+		// The password RDS manages is rotated every 7 days, after which the
+		// instances would keep the one they read at boot
+		db.invalid("passwordMode", "managed is not supported, since RDS rotates the password and the instances only read it at boot")
+	} else if !slices.Contains(infra.PasswordModes, c.Database.PasswordMode) {
+		db.invalid("passwordMode", "%q must be one of %s", c.Database.PasswordMode, strings.Join(infra.PasswordModes, ", "))
+	}
+	if tier := c.subnetTier(c.Database.SubnetTier); tier == nil {
+		db.invalid("subnetTier", "%q is not one of the subnet tiers", c.Database.SubnetTier)
+	} else if tier.Public {
+		db.invalid("subnetTier", "%q is a public tier", c.Database.SubnetTier)
+	}
+	if _, ipNet, err := net.ParseCIDR(p.Ipv4Cidr); err != nil || ipNet.IP.To4() == nil {
+		project.invalid("ipv4Cidr", "%q is not an IPv4 CIDR block", p.Ipv4Cidr)
+	}
+	if _, ipNet, err := net.ParseCIDR(p.Ipv6Cidr); err != nil || ipNet.IP.To4() != nil {
+		project.invalid("ipv6Cidr", "%q is not an IPv6 CIDR block", p.Ipv6Cidr)
+	}
+	if !strings.HasPrefix(p.AmiId, "ami-") {
+		project.invalid("amiId", "%q is not an AMI id", p.AmiId)
+	}
+	validatePorts(project, "ports", p.Ports)
+	if !slices.Contains(infra.AccessModes, p.AccessMode) {
+		project.invalid("accessMode", "%q must be one of %s", p.AccessMode, strings.Join(infra.AccessModes, ", "))
+	}
+	logging := p.SessionLogging
+	if logging.Enabled() && p.AccessMode != infra.AccessSsm {
+		project.invalid("sessionLogging", "needs accessMode %s", infra.AccessSsm)
+	}
+	if logging.RetentionDays != 0 && !logging.CloudWatch {
+		project.invalid("sessionLogging", "retentionDays needs cloudWatch")
+	} else if logging.RetentionDays != 0 && !slices.Contains(infra.LogRetentionDays, logging.RetentionDays) {
+		project.invalid("sessionLogging", "retentionDays %d is not a retention CloudWatch Logs accepts", logging.RetentionDays)
+	}
+	if logging.S3KeyPrefix != "" && logging.S3Bucket == "" {
+		project.invalid("sessionLogging", "s3KeyPrefix needs s3Bucket")
+	}
+	if p.SslPolicy != "" && !strings.HasPrefix(p.SslPolicy, "ELBSecurityPolicy-") {
+		project.invalid("sslPolicy", "%q is not an ELBSecurityPolicy", p.SslPolicy)
+	}
+	if !slices.Contains(infra.CertificateModes, p.CertificateMode) {
+		project.invalid("certificateMode", "%q must be one of %s", p.CertificateMode, strings.Join(infra.CertificateModes, ", "))
+	}
+	if len(p.CertificateSans) > 0 && p.CertificateMode != infra.CertificateIssue {
+		project.invalid("certificateSans", "needs certificateMode %s", infra.CertificateIssue)
+	}
+	if !slices.Contains(infra.HostedZoneModes, p.HostedZoneMode) {
+		project.invalid("hostedZoneMode", "%q must be one of %s", p.HostedZoneMode, strings.Join(infra.HostedZoneModes, ", "))
+	}
+	if p.ParentZoneId != "" && p.HostedZoneMode != infra.HostedZoneCreate {
+		project.invalid("parentZoneId", "needs hostedZoneMode %s", infra.HostedZoneCreate)
+	}
+	if (p.ParentZoneProfile != "" || p.ParentZoneRoleArn != "") && p.ParentZoneId == "" {
+		project.invalid("parentZoneId", "is required to use the parent zone credentials")
+	}
+	if p.ParentZoneRoleArn != "" && !strings.HasPrefix(p.ParentZoneRoleArn, "arn:") {
+		project.invalid("parentZoneRoleArn", "%q is not an ARN", p.ParentZoneRoleArn)
+	}
+	if err := infra.ValidateListeners(p.Listeners); err != nil {
+		project.invalidEach("listeners", err)
+	}
+	listenerPorts := infra.ListenerPorts(p.Listeners)
+	for _, port := range p.LoadBalancerPorts {
+		validatePort(project, "loadBalancerPorts", port)
+		if !slices.Contains(listenerPorts, port) {
+			project.invalid("loadBalancerPorts", "port %d is opened but has no listener", port)
+		}
+	}
+	if len(p.LoadBalancerPorts) > 0 {
+		for _, port := range listenerPorts {
+			if !slices.Contains(p.LoadBalancerPorts, port) {
+				project.invalid("loadBalancerPorts", "port %d has a listener but is not listed", port)
+			}
+		}
+	}
+	if p.RootVolumeSize < 0 {
+		project.invalid("rootVolumeSize", "%d must not be negative", p.RootVolumeSize)
+	}
+	if !slices.Contains(rootVolumeTypes, p.RootVolumeType) {
+		project.invalid("rootVolumeType", "%q must be one of %s", p.RootVolumeType, strings.Join(rootVolumeTypes, ", "))
+	}
+
+	for key, value := range c.Tags.AwsTags() {
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			project.invalid("tags", "tag key %q must not start with aws:", key)
+		} else if len(key) > 128 || len(value) > 256 {
+			project.invalid("tags", "tag %q is longer than AWS allows (128 characters for keys, 256 for values)", key)
+		}
+	}
+
+	if infra.DatabaseBackend(c.Database.Engine) == infra.DatabaseInstance && c.Database.StorageSize < 20 {
+		db.invalid("storageSize", "%d must be at least 20 GiB", c.Database.StorageSize)
+	}
+	validatePort(db, "port", c.Database.Port)
+	d := c.Database
+	switch family := infra.ParameterGroupFamily(d.Engine, d.EngineVersion); {
+	case d.Engine == "" || d.EngineVersion == "" || d.Family == "":
+		// Already reported as required
+	case !slices.Contains(infra.DatabaseEngines(), d.Engine):
+		db.invalid("engine", "%q must be one of %s", d.Engine, strings.Join(infra.DatabaseEngines(), ", "))
+	case d.Family != family:
+		db.invalid("family", "%q is not the family of %s %s, want %s", d.Family, d.Engine, d.EngineVersion, family)
+	}
+	if err := infra.ValidateParameters(d.Engine, d.Parameters); err != nil {
+		db.invalidEach("parameters", err)
+	}
+	if err := infra.ValidateParameters(d.Engine, d.InstanceParameters); err != nil {
+		db.invalidEach("instanceParameters", err)
+	}
+	if len(d.InstanceParameters) > 0 && infra.DatabaseBackend(d.Engine) != infra.DatabaseAurora {
+		db.invalid("instanceParameters", "only applies to the Aurora engines, set parameters instead")
+	}
+	if err := infra.ValidateOptions(d.Engine, d.Options); err != nil {
+		db.invalidEach("options", err)
+	}
+	validateDatabaseHardening(db, c.Database.Profile, c.Database.Hardening)
+	if infra.DatabaseBackend(d.Engine) == infra.DatabaseAurora {
+		validateAuroraCluster(db, d)
+	}
+
+	a := c.Application
+	validatePort(app, "port", a.Port)
+	for _, alias := range a.Aliases {
+		if a.Hostname != "" && !strings.HasSuffix(alias, "."+a.Hostname) {
+			app.invalid("aliases", "%q is not in the hosted zone of %s", alias, a.Hostname)
+		}
+	}
+	if !strings.HasPrefix(a.HealthCheckPath, "/") {
+		app.invalid("healthCheckPath", "%q must start with /", a.HealthCheckPath)
+	}
+	for _, file := range []struct{ key, path string }{
+		{"resourceFile", a.ResourceFile},
+		{"propertyFile", a.PropertyFile},
+		{"logFile", a.LogFile},
+		{"cloudwatchConfigFile", a.CloudwatchConfigFile},
+		{"binaryFile", a.BinaryFile},
+	} {
+		if !path.IsAbs(file.path) {
+			app.invalid(file.key, "%q must be an absolute path", file.path)
+		}
+	}
+}
+
+// expandHostname fills in the placeholders of a hostname template, e.g.
+// {env}.{domain}, and checks that the result is a valid hostname.
+func expandHostname(template string, values map[string]string) (string, error) {
+	var errs []error
+	hostname := hostnamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := values[strings.Trim(placeholder, "{}")]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%q uses unknown placeholder %s", template, placeholder))
+		} else if value == "" {
+			errs = append(errs, fmt.Errorf("%q uses %s, which is not set", template, placeholder))
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	hostname = strings.ToLower(hostname)
+	if !hostnamePattern.MatchString(hostname) {
+		return "", fmt.Errorf("%q expands to %q, which is not a valid hostname", template, hostname)
+	}
+	return hostname, nil
+}
+
+// validateDatabaseHardening checks the hardening options of the database,
+// and that the prod profile is not overridden with unsafe ones.
+func validateDatabaseHardening(r configReader, profile string, h infra.DatabaseHardening) {
+	if _, ok := infra.DatabaseProfiles[profile]; !ok {
+		r.invalid("profile", "%q must be one of %s, %s", profile, infra.DatabaseProfileDev, infra.DatabaseProfileProd)
+	}
+	if h.KmsKeyId != "" {
+		if !h.StorageEncrypted {
+			r.invalid("kmsKeyId", "is only used with storageEncrypted")
+		} else if !strings.HasPrefix(h.KmsKeyId, "arn:") {
+			r.invalid("kmsKeyId", "%q is not a KMS key ARN", h.KmsKeyId)
+		}
+	}
+	if h.BackupRetentionDays < 0 || h.BackupRetentionDays > 35 {
+		r.invalid("backupRetentionDays", "%d is outside 0-35", h.BackupRetentionDays)
+	}
+	if h.BackupWindow != "" && !backupWindow.MatchString(h.BackupWindow) {
+		r.invalid("backupWindow", "%q is not a hh24:mi-hh24:mi range", h.BackupWindow)
+	}
+	if !slices.Contains(infra.MonitoringIntervals, h.MonitoringInterval) {
+		r.invalid("monitoringInterval", "%d is not an interval enhanced monitoring accepts", h.MonitoringInterval)
+	}
+
+	if profile != infra.DatabaseProfileProd {
+		return
+	}
+	prod := infra.DatabaseProfiles[infra.DatabaseProfileProd]
+	if !h.StorageEncrypted {
+		r.invalid("storageEncrypted", "must be true with the prod profile")
+	}
+	if !h.MultiAz {
+		r.invalid("multiAz", "must be true with the prod profile")
+	}
+	if !h.DeletionProtection {
+		r.invalid("deletionProtection", "must be true with the prod profile")
+	}
+	if h.BackupRetentionDays < prod.BackupRetentionDays {
+		r.invalid("backupRetentionDays", "%d must be at least %d with the prod profile", h.BackupRetentionDays, prod.BackupRetentionDays)
+	}
+	if h.SkipFinalSnapshot {
+		r.invalid("skipFinalSnapshot", "must be false with the prod profile")
+	}
+}
+
+// validateAuroraCluster checks the shape of the Aurora cluster of an Aurora
+// engine.
+func validateAuroraCluster(r configReader, d DatabaseConfig) {
+	if d.Readers < 0 || d.Readers > infra.MaxReaders {
+		r.invalid("readers", "%d is outside 0-%d", d.Readers, infra.MaxReaders)
+	} else if d.Readers == 0 && d.Hardening.MultiAz {
+		r.invalid("readers", "a cluster without readers is in a single availability zone, which multiAz does not allow")
+	}
+	if s := d.Serverless; s != nil {
+		if s.MinCapacity < infra.MinServerlessCapacity || s.MaxCapacity > infra.MaxServerlessCapacity || s.MinCapacity > s.MaxCapacity {
+			r.invalid("serverless", "capacity %g-%g must be a range within %g-%d", s.MinCapacity, s.MaxCapacity, infra.MinServerlessCapacity, infra.MaxServerlessCapacity)
+		}
+		for _, capacity := range []float64{s.MinCapacity, s.MaxCapacity} {
+			if math.Mod(capacity, infra.MinServerlessCapacity) != 0 {
+				r.invalid("serverless", "capacity %g is not a multiple of %g", capacity, infra.MinServerlessCapacity)
+			}
+		}
+		if d.InstanceClass != infra.ServerlessInstanceClass {
+			r.invalid("instanceClass", "%q must be %s with serverless", d.InstanceClass, infra.ServerlessInstanceClass)
+		}
+	}
+	// Aurora always keeps backups
+	if d.Hardening.BackupRetentionDays < 1 {
+		r.invalid("backupRetentionDays", "%d must be at least 1 with the %s backend", d.Hardening.BackupRetentionDays, infra.DatabaseAurora)
+	}
+}
+
+func validatePorts(r configReader, key string, ports []int) {
+	if len(ports) == 0 {
+		r.invalid(key, "must list at least one port")
+	}
+	for _, port := range ports {
+		validatePort(r, key, port)
+	}
+}
+
+func validatePort(r configReader, key string, port int) {
+	if port < 1 || port > 65535 {
+		r.invalid(key, "port %d is outside 1-65535", port)
+	}
+}
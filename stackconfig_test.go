@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"iac-pulumi/infra"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// loadConfig runs LoadStackConfig against mocks with testConfig changed by
+// overrides. An empty override value removes the key.
+func loadConfig(t *testing.T, overrides map[string]string) (*StackConfig, error) {
+	t.Helper()
+	var cfg *StackConfig
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		var err error
+		cfg, err = LoadStackConfig(ctx)
+		return err
+	}, pulumi.WithMocks("iac-pulumi", "test", &mocks{}), withConfig(configWith(overrides)))
+	return cfg, err
+}
+
+func TestLoadStackConfig(t *testing.T) {
+	cfg, err := loadConfig(t, nil)
+	if err != nil {
+		t.Fatalf("loading a valid config: %v", err)
+	}
+	if cfg.Project.VpcCidr != "10.0.0.0/16" {
+		t.Errorf("VpcCidr = %q, want 10.0.0.0/16", cfg.Project.VpcCidr)
+	}
+	if ports := infra.ListenerPorts(cfg.Project.Listeners); !slices.Equal(ports, []int{443, 80}) {
+		t.Errorf("listener ports = %v, want [443 80]", ports)
+	}
+	if cfg.Project.RootVolumeSize != 25 || cfg.Project.RootVolumeType != "gp2" {
+		t.Errorf("root volume = %d %s, want 25 gp2", cfg.Project.RootVolumeSize, cfg.Project.RootVolumeType)
+	}
+	if cfg.Database.Port != 3306 || cfg.Application.Port != 8080 {
+		t.Errorf("ports = %d/%d, want 3306/8080", cfg.Database.Port, cfg.Application.Port)
+	}
+}
+
+func TestLoadStackConfigReportsEveryInvalidKey(t *testing.T) {
+	_, err := loadConfig(t, map[string]string{
+		"iac-pulumi:vpcCidr":           "10.0.0/16",
+		"iac-pulumi:subnetTiers":       `[{"name": "private", "prefixLength": 24}]`,
+		"iac-pulumi:natMode":           "gateway",
+		"iac-pulumi:ipv6Cidr":          "0.0.0.0/0",
+		"iac-pulumi:loadBalancerPorts": "[80,70000]",
+		"iac-pulumi:rootVolumeSize":    "large",
+		"iac-pulumi:rootVolumeType":    "ssd",
+		"iac-pulumi:accessMode":        "ssh",
+		"iac-pulumi:sshKeyName":        "",
+		"database:port":                "0",
+		"database:passwordMode":        "vault",
+		"application:healthCheckPath":  "healthz",
+		"application:logFile":          "app.log",
+		"smtp:key":                     "",
+	})
+	var configErrs ConfigErrors
+	if !errors.As(err, &configErrs) {
+		t.Fatalf("got error %v, want ConfigErrors", err)
+	}
+
+	want := []string{
+		"iac-pulumi:vpcCidr",
+		"iac-pulumi:subnetTiers",
+		"iac-pulumi:natMode",
+		"iac-pulumi:ipv6Cidr",
+		"iac-pulumi:loadBalancerPorts",
+		"iac-pulumi:rootVolumeSize",
+		"iac-pulumi:rootVolumeType",
+		"iac-pulumi:sshKeyName",
+		"database:port",
+		"database:passwordMode",
+		"application:healthCheckPath",
+		"application:logFile",
+		"smtp:key",
+	}
+	for _, key := range want {
+		if !configErrs.has(key) {
+			t.Errorf("%s was not reported in:\n%v", key, err)
+		}
+	}
+	if len(configErrs) != len(want) {
+		t.Errorf("got %d problems, want %d:\n%v", len(configErrs), len(want), err)
+	}
+}
+
+func TestLoadStackConfigPrivateInstancesNeedEgress(t *testing.T) {
+	_, err := loadConfig(t, map[string]string{"iac-pulumi:instanceSubnetTier": "private"})
+	var configErrs ConfigErrors
+	if !errors.As(err, &configErrs) || !configErrs.has("iac-pulumi:instanceSubnetTier") {
+		t.Errorf("got error %v, want instanceSubnetTier to be reported", err)
+	}
+
+	if _, err := loadConfig(t, map[string]string{
+		"iac-pulumi:instanceSubnetTier": "private",
+		"iac-pulumi:natMode":            "per-az",
+	}); err != nil {
+		t.Errorf("loading private instances with a NAT: %v", err)
+	}
+	if _, err := loadConfig(t, map[string]string{
+		"iac-pulumi:instanceSubnetTier": "private",
+		"iac-pulumi:vpcEndpoints":       `["logs", "monitoring", "secretsmanager", "sns"]`,
+	}); err != nil {
+		t.Errorf("loading private instances with VPC endpoints: %v", err)
+	}
+
+	_, err = loadConfig(t, map[string]string{"iac-pulumi:vpcEndpoints": `["logs", "monitoring", "sns"]`})
+	if !errors.As(err, &configErrs) || !strings.Contains(err.Error(), `"secretsmanager" is called by the instances`) {
+		t.Errorf("got error %v, want the missing secretsmanager endpoint to be reported", err)
+	}
+
+	_, err = loadConfig(t, map[string]string{"iac-pulumi:vpcEndpoints": `["logs", "monitoring", "secretsmanager", "sns", "sqs"]`})
+	if !errors.As(err, &configErrs) || !configErrs.has("iac-pulumi:vpcEndpoints") {
+		t.Errorf("got error %v, want the unknown endpoint service to be reported", err)
+	}
+}
+
+func TestLoadStackConfigNaming(t *testing.T) {
+	cfg, err := loadConfig(t, map[string]string{"iac-pulumi:namingPattern": ""})
+	if err != nil {
+		t.Fatalf("loading a stack without a naming pattern: %v", err)
+	}
+	if cfg.Names.VpcName != "my-vpc" {
+		t.Errorf("VpcName = %q, want the legacy my-vpc", cfg.Names.VpcName)
+	}
+
+	// The old keys still name their resource
+	cfg, err = loadConfig(t, map[string]string{"iac-pulumi:vpcName": "main-vpc"})
+	if err != nil {
+		t.Fatalf("loading the legacy vpcName key: %v", err)
+	}
+	if cfg.Names.VpcName != "main-vpc" {
+		t.Errorf("VpcName = %q, want main-vpc from the legacy key", cfg.Names.VpcName)
+	}
+	if _, err := loadConfig(t, map[string]string{
+		"iac-pulumi:vpcName": "main-vpc",
+		"iac-pulumi:names":   `{"vpc": "main-vpc"}`,
+	}); err != nil {
+		t.Errorf("loading a legacy key that agrees with names: %v", err)
+	}
+
+	_, err = loadConfig(t, map[string]string{
+		"iac-pulumi:vpcName": "main-vpc",
+		"iac-pulumi:names":   `{"vpc": "other-vpc"}`,
+	})
+	var configErrs ConfigErrors
+	if !errors.As(err, &configErrs) || !configErrs.has("iac-pulumi:vpcName") {
+		t.Errorf("got error %v, want the legacy vpcName key that conflicts with names to be reported", err)
+	}
+}
+
+func TestLoadStackConfigLoadBalancerPortsNeedListeners(t *testing.T) {
+	_, err := loadConfig(t, map[string]string{"iac-pulumi:loadBalancerPorts": "[80,443,8443]"})
+	var configErrs ConfigErrors
+	if !errors.As(err, &configErrs) || !strings.Contains(err.Error(), "port 8443 is opened but has no listener") {
+		t.Errorf("got error %v, want the port without a listener to be reported", err)
+	}
+
+	if _, err := loadConfig(t, map[string]string{"iac-pulumi:loadBalancerPorts": "[80,443]"}); err != nil {
+		t.Errorf("loading ports that match the listeners: %v", err)
+	}
+}
+
+func TestLoadStackConfigPasswordMode(t *testing.T) {
+	cfg, err := loadConfig(t, map[string]string{"database:masterPassword": "test-password"})
+	if err != nil {
+		t.Fatalf("loading the config: %v", err)
+	}
+	if cfg.Database.PasswordMode != infra.PasswordConfig {
+		t.Errorf("PasswordMode = %q, want %q when masterPassword is set", cfg.Database.PasswordMode, infra.PasswordConfig)
+	}
+
+	_, err = loadConfig(t, map[string]string{
+		"database:masterPassword": "test-password",
+		"database:passwordMode":   infra.PasswordGenerate,
+	})
+	var configErrs ConfigErrors
+	if !errors.As(err, &configErrs) || !configErrs.has("database:masterPassword") {
+		t.Errorf("got %v, want masterPassword to be rejected in generate mode", err)
+	}
+
+	_, err = loadConfig(t, map[string]string{"database:passwordMode": "managed"})
+	if !errors.As(err, &configErrs) || !strings.Contains(err.Error(), "RDS rotates the password") {
+		t.Errorf("got %v, want the managed mode to be rejected", err)
+	}
+}
+
+func TestLoadStackConfigAccessMode(t *testing.T) {
+	cfg, err := loadConfig(t, nil)
+	if err != nil {
+		t.Fatalf("loading the config: %v", err)
+	}
+	if cfg.Project.AccessMode != infra.AccessSsh {
+		t.Errorf("AccessMode = %q, want %q when sshKeyName is set", cfg.Project.AccessMode, infra.AccessSsh)
+	}
+	cfg, err = loadConfig(t, map[string]string{"iac-pulumi:sshKeyName": ""})
+	if err != nil {
+		t.Fatalf("loading the config: %v", err)
+	}
+	if cfg.Project.AccessMode != infra.AccessSsm {
+		t.Errorf("AccessMode = %q, want %q without sshKeyName", cfg.Project.AccessMode, infra.AccessSsm)
+	}
+
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		key       string
+	}{
+		{"key pair with session manager", map[string]string{"iac-pulumi:accessMode": "ssm"}, "iac-pulumi:sshKeyName"},
+		{"unknown mode", map[string]string{"iac-pulumi:accessMode": "telnet"}, "iac-pulumi:accessMode"},
+		{"session logging with ssh", map[string]string{"iac-pulumi:sessionLogging": `{"cloudWatch": true}`}, "iac-pulumi:sessionLogging"},
+		{"retention", map[string]string{
+			"iac-pulumi:sshKeyName":     "",
+			"iac-pulumi:sessionLogging": `{"cloudWatch": true, "retentionDays": 10}`,
+		}, "iac-pulumi:sessionLogging"},
+		{"private instances", map[string]string{
+			"iac-pulumi:sshKeyName":         "",
+			"iac-pulumi:instanceSubnetTier": "private",
+			"iac-pulumi:vpcEndpoints":       `["logs", "monitoring", "secretsmanager", "sns", "ssm"]`,
+		}, "iac-pulumi:vpcEndpoints"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.overrides)
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) || !configErrs.has(test.key) {
+				t.Errorf("got %v, want %s to be reported", err, test.key)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigDatabaseProfile(t *testing.T) {
+	cfg, err := loadConfig(t, map[string]string{
+		"database:profile":             "prod",
+		"database:backupRetentionDays": "14",
+	})
+	if err != nil {
+		t.Fatalf("loading the config: %v", err)
+	}
+	want := infra.DatabaseProfiles[infra.DatabaseProfileProd]
+	want.BackupRetentionDays = 14
+	if cfg.Database.Hardening != want {
+		t.Errorf("Hardening = %+v, want the prod preset with 14 days of backups", cfg.Database.Hardening)
+	}
+
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		key       string
+	}{
+		{"unknown profile", map[string]string{"database:profile": "staging"}, "database:profile"},
+		{"unencrypted prod", map[string]string{"database:profile": "prod", "database:storageEncrypted": "false"}, "database:storageEncrypted"},
+		{"single zone prod", map[string]string{"database:profile": "prod", "database:multiAz": "false"}, "database:multiAz"},
+		{"unprotected prod", map[string]string{"database:profile": "prod", "database:deletionProtection": "false"}, "database:deletionProtection"},
+		{"short prod backups", map[string]string{"database:profile": "prod", "database:backupRetentionDays": "3"}, "database:backupRetentionDays"},
+		{"prod without snapshot", map[string]string{"database:profile": "prod", "database:skipFinalSnapshot": "true"}, "database:skipFinalSnapshot"},
+		{"key without encryption", map[string]string{
+			"database:kmsKeyId":         "arn:aws:kms:us-east-1:123456789012:key/test",
+			"database:storageEncrypted": "",
+		}, "database:kmsKeyId"},
+		{"backup window", map[string]string{"database:backupWindow": "3:00-25:00"}, "database:backupWindow"},
+		{"monitoring interval", map[string]string{"database:monitoringInterval": "20"}, "database:monitoringInterval"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.overrides)
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) || !configErrs.has(test.key) {
+				t.Errorf("got %v, want %s to be reported", err, test.key)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigDatabaseEngine(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		key       string
+	}{
+		{"unknown engine", map[string]string{"database:engine": "oracle-ee"}, "database:engine"},
+		{"family of another engine", map[string]string{"database:family": "mysql8.0"}, "database:family"},
+		{"family of another version", map[string]string{"database:family": "mariadb10.6"}, "database:family"},
+		{"parameter of another engine", map[string]string{"database:parameters": `{"DateStyle": {"value": "ISO"}}`}, "database:parameters"},
+		{"apply method", map[string]string{"database:parameters": `{"max_connections": {"value": "200", "applyMethod": "now"}}`}, "database:parameters"},
+		{"instance parameters of an instance", map[string]string{"database:instanceParameters": `{"max_connections": {"value": "200"}}`}, "database:instanceParameters"},
+		{"options of postgres", map[string]string{
+			"database:engine":        "postgres",
+			"database:engineVersion": "15.4",
+			"database:family":        "postgres15",
+			"database:options":       `[{"name": "MARIADB_AUDIT_PLUGIN"}]`,
+		}, "database:options"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.overrides)
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) || !configErrs.has(test.key) {
+				t.Errorf("got %v, want %s to be reported", err, test.key)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigAurora(t *testing.T) {
+	aurora := func(overrides map[string]string) map[string]string {
+		config := map[string]string{
+			"database:engine":        "aurora-postgresql",
+			"database:engineVersion": "15.4",
+			"database:family":        "aurora-postgresql15",
+			"database:storageSize":   "",
+		}
+		for key, value := range overrides {
+			config[key] = value
+		}
+		return config
+	}
+	cfg, err := loadConfig(t, aurora(map[string]string{
+		"database:instanceClass": "",
+		"database:serverless":    `{"minCapacity": 0.5, "maxCapacity": 4}`,
+	}))
+	if err != nil {
+		t.Fatalf("loading the config: %v", err)
+	}
+	if cfg.Database.InstanceClass != infra.ServerlessInstanceClass || cfg.Database.Serverless.MaxCapacity != 4 {
+		t.Errorf("Database = %+v, want a serverless cluster of up to 4 units", cfg.Database)
+	}
+
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		key       string
+	}{
+		{"readers of an instance", map[string]string{"database:readers": "1"}, "database:readers"},
+		{"storage of a cluster", aurora(map[string]string{"database:storageSize": "20"}), "database:storageSize"},
+		{"too many readers", aurora(map[string]string{"database:readers": "16"}), "database:readers"},
+		{"prod without readers", aurora(map[string]string{"database:profile": "prod"}), "database:readers"},
+		{"no backups", aurora(map[string]string{"database:backupRetentionDays": "0"}), "database:backupRetentionDays"},
+		{"capacity range", aurora(map[string]string{"database:serverless": `{"minCapacity": 8, "maxCapacity": 4}`}), "database:serverless"},
+		{"capacity step", aurora(map[string]string{"database:serverless": `{"minCapacity": 0.75, "maxCapacity": 4}`}), "database:serverless"},
+		{"serverless instance class", aurora(map[string]string{
+			"database:serverless":    `{"minCapacity": 1, "maxCapacity": 4}`,
+			"database:instanceClass": "db.r6g.large",
+		}), "database:instanceClass"},
+		{"options of a cluster", aurora(map[string]string{"database:options": `[{"name": "MARIADB_AUDIT_PLUGIN"}]`}), "database:options"},
+		{"instance parameter name", aurora(map[string]string{"database:instanceParameters": `{"Max Connections": {"value": "200"}}`}), "database:instanceParameters"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.overrides)
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) || !configErrs.has(test.key) {
+				t.Errorf("got %v, want %s to be reported", err, test.key)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigHostname(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		want      string
+	}{
+		{"profile", nil, "dev.example.com"},
+		{"no profile", map[string]string{"aws:profile": ""}, "test.example.com"},
+		{"template", map[string]string{"application:hostname": "{env}.apps.{domain}"}, "test.apps.example.com"},
+		{"fixed", map[string]string{"application:hostname": "www.example.org"}, "www.example.org"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(t, test.overrides)
+			if err != nil {
+				t.Fatalf("loading the config: %v", err)
+			}
+			if cfg.Application.Hostname != test.want {
+				t.Errorf("Hostname = %q, want %q", cfg.Application.Hostname, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadStackConfigRejectsInvalidHostnames(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides map[string]string
+		key       string
+	}{
+		{"profile unset", map[string]string{"aws:profile": "", "application:hostname": "{profile}.{domain}"}, "application:hostname"},
+		{"unknown placeholder", map[string]string{"application:hostname": "{region}.{domain}"}, "application:hostname"},
+		{"invalid hostname", map[string]string{"application:hostname": "{env}_{domain}"}, "application:hostname"},
+		{"alias outside the zone", map[string]string{"application:aliases": `["www.example.org"]`}, "application:aliases"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, test.overrides)
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) {
+				t.Fatalf("got %v, want ConfigErrors", err)
+			}
+			if !strings.Contains(err.Error(), test.key) {
+				t.Errorf("error %q does not mention %s", err, test.key)
+			}
+		})
+	}
+}
+
+func TestNewStackFailsBeforeRegisteringResources(t *testing.T) {
+	m := &mocks{}
+	config := configWith(map[string]string{"application:port": "http"})
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err := newStack(ctx)
+		return err
+	}, pulumi.WithMocks("iac-pulumi", "test", m), withConfig(config))
+	if err == nil {
+		t.Fatalf("expected an invalid application:port to fail the stack")
+	}
+	if len(m.resources) != 0 {
+		t.Errorf("%d resources were registered before the config was validated", len(m.resources))
+	}
+}